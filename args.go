@@ -0,0 +1,390 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// InvalidArgsError is returned by ParseArgs when command arguments don't match args struct
+var InvalidArgsError = errors.New("invalid arguments")
+
+// argsField describes single positional argument or flag of args struct
+type argsField struct {
+	name     string
+	index    int
+	flag     bool
+	required bool
+	def      string
+	hasDef   bool
+	kind     reflect.Kind
+	rest     bool
+}
+
+// argsSpec describes args struct
+type argsSpec struct {
+	typ        reflect.Type
+	positional []argsField
+	flags      map[string]argsField
+	flagOrder  []string
+}
+
+// newArgsSpec reads tags of struct fields:
+//
+//	arg:"name"      positional argument, positions follow fields order
+//	flag:"name"     flag given as --name=value or --name value, bool flags don't need value
+//	default:"value" value used when argument is not given
+//	required:"true" argument must be given
+//
+// Supported field types are string, bool, ints, uints, floats
+// and []string for the last positional argument, which takes the rest of arguments
+func newArgsSpec(t reflect.Type) (*argsSpec, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("args must be a struct or pointer to struct, got %s", t)
+	}
+
+	spec := &argsSpec{typ: t, flags: make(map[string]argsField)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		argName, isArg := sf.Tag.Lookup("arg")
+		flagName, isFlag := sf.Tag.Lookup("flag")
+		if !isArg && !isFlag {
+			continue
+		}
+		if isArg && isFlag {
+			return nil, fmt.Errorf("field %s can't be both arg and flag", sf.Name)
+		}
+
+		field := argsField{
+			name:     argName,
+			index:    i,
+			flag:     isFlag,
+			required: sf.Tag.Get("required") == "true",
+			kind:     sf.Type.Kind(),
+		}
+		if isFlag {
+			field.name = flagName
+		}
+		if field.name == "" {
+			field.name = strings.ToLower(sf.Name)
+		}
+		field.def, field.hasDef = sf.Tag.Lookup("default")
+
+		switch {
+		case field.kind == reflect.Slice && sf.Type.Elem().Kind() == reflect.String && isArg:
+			field.rest = true
+		case isSupportedArgKind(field.kind):
+		default:
+			return nil, fmt.Errorf("field %s has unsupported type %s", sf.Name, sf.Type)
+		}
+		if field.hasDef && !field.rest {
+			if err := setArg(reflect.New(sf.Type).Elem(), field.def); err != nil {
+				return nil, fmt.Errorf("field %s has invalid default: %w", sf.Name, err)
+			}
+		}
+
+		if isFlag {
+			spec.flags[field.name] = field
+			spec.flagOrder = append(spec.flagOrder, field.name)
+			continue
+		}
+		if n := len(spec.positional); n > 0 && spec.positional[n-1].rest {
+			return nil, fmt.Errorf("field %s follows []string argument", sf.Name)
+		}
+		spec.positional = append(spec.positional, field)
+	}
+	return spec, nil
+}
+
+func isSupportedArgKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setArg converts s to type of v and stores it
+func setArg(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a positive integer", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// splitArgs splits text by spaces, text in double quotes is kept as single argument
+func splitArgs(text string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quoted  bool
+	)
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case unicode.IsSpace(r) && !quoted:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unclosed quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// parse fills struct v with arguments from text
+func (spec *argsSpec) parse(text string, v reflect.Value) error {
+	tokens, err := splitArgs(text)
+	if err != nil {
+		return fmt.Errorf("%w: %s", InvalidArgsError, err)
+	}
+
+	given := make(map[string]bool)
+	var positional []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == "--" {
+			positional = append(positional, tokens[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(token, "--") || len(token) == 2 {
+			positional = append(positional, token)
+			continue
+		}
+
+		name, value := token[2:], ""
+		hasValue := false
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		field, ok := spec.flags[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown flag --%s", InvalidArgsError, name)
+		}
+		if !hasValue {
+			if field.kind == reflect.Bool {
+				value = "true"
+			} else if i+1 < len(tokens) {
+				i++
+				value = tokens[i]
+			} else {
+				return fmt.Errorf("%w: flag --%s needs a value", InvalidArgsError, name)
+			}
+		}
+		if err := setArg(v.Field(field.index), value); err != nil {
+			return fmt.Errorf("%w: --%s: %s", InvalidArgsError, name, err)
+		}
+		given[name] = true
+	}
+
+	for _, name := range spec.flagOrder {
+		field := spec.flags[name]
+		if given[name] {
+			continue
+		}
+		if field.required {
+			return fmt.Errorf("%w: flag --%s is required", InvalidArgsError, name)
+		}
+		if field.hasDef {
+			_ = setArg(v.Field(field.index), field.def)
+		}
+	}
+
+	for i, field := range spec.positional {
+		if field.rest {
+			if len(positional) > i {
+				v.Field(field.index).Set(reflect.ValueOf(append([]string(nil), positional[i:]...)))
+				positional = positional[:i]
+			} else if field.required {
+				return fmt.Errorf("%w: argument <%s> is required", InvalidArgsError, field.name)
+			} else if field.hasDef {
+				v.Field(field.index).Set(reflect.ValueOf(strings.Fields(field.def)))
+			}
+			break
+		}
+		if i >= len(positional) {
+			if field.required {
+				return fmt.Errorf("%w: argument <%s> is required", InvalidArgsError, field.name)
+			}
+			if field.hasDef {
+				_ = setArg(v.Field(field.index), field.def)
+			}
+			continue
+		}
+		if err := setArg(v.Field(field.index), positional[i]); err != nil {
+			return fmt.Errorf("%w: <%s>: %s", InvalidArgsError, field.name, err)
+		}
+	}
+	if len(positional) > len(spec.positional) {
+		return fmt.Errorf("%w: too many arguments", InvalidArgsError)
+	}
+	return nil
+}
+
+// usage returns usage line like "/buy <item> [count] [--gift] --note=<note>"
+func (spec *argsSpec) usage(command string) string {
+	parts := []string{command}
+	for _, field := range spec.positional {
+		name := field.name
+		if field.rest {
+			name += "..."
+		}
+		if field.required {
+			parts = append(parts, "<"+name+">")
+		} else {
+			parts = append(parts, "["+name+"]")
+		}
+	}
+	for _, name := range spec.flagOrder {
+		field := spec.flags[name]
+		part := "--" + name
+		if field.kind != reflect.Bool {
+			part += "=<" + name + ">"
+		}
+		if !field.required {
+			part = "[" + part + "]"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseArgs parses command arguments text into struct pointed by v.
+// Fields are described with tags:
+//
+//	type BuyArgs struct {
+//		Item  string `arg:"item" required:"true"`
+//		Count int    `arg:"count" default:"1"`
+//		Gift  bool   `flag:"gift"`
+//	}
+//
+// Errors caused by user input wrap InvalidArgsError
+func ParseArgs(text string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("args must be a non-nil pointer to struct")
+	}
+	spec, err := newArgsSpec(rv.Type())
+	if err != nil {
+		return err
+	}
+	return spec.parse(text, rv.Elem())
+}
+
+// ArgsUsage returns usage line for command with arguments described by v
+func ArgsUsage(command string, v interface{}) (string, error) {
+	spec, err := newArgsSpec(reflect.TypeOf(v))
+	if err != nil {
+		return "", err
+	}
+	return spec.usage(command), nil
+}
+
+type commandArgsKey struct{}
+
+// CommandArgs returns arguments parsed for handler registered with RegisterCommandArgs.
+// Value is a pointer to new instance of args struct
+// For example:
+//
+//	args := tgbot.CommandArgs(bot.Context(update)).(*BuyArgs)
+func CommandArgs(ctx context.Context) interface{} {
+	return ctx.Value(commandArgsKey{})
+}
+
+// RegisterCommandArgs binds handler for command with typed arguments described by args struct (see ParseArgs).
+// Arguments are parsed and validated before the handler is called,
+// if they are invalid, framework replies with error and usage message and handler is not called.
+// Parsed arguments are available with CommandArgs
+func (bot *BotFramework) RegisterCommandArgs(name string, args interface{}, f CommonHandler, chatID int64, mw ...Middleware) error {
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	if args == nil {
+		return errors.New("args must not be nil")
+	}
+	spec, err := newArgsSpec(reflect.TypeOf(args))
+	if err != nil {
+		return err
+	}
+
+	handler := func(bot *BotFramework, update *tgbotapi.Update) error {
+		v := reflect.New(spec.typ)
+		if err := spec.parse(commandArguments(update.Message), v.Elem()); err != nil {
+			if !errors.Is(err, InvalidArgsError) {
+				return err
+			}
+			_, err = bot.Send(tgbotapi.NewMessage(
+				bot.GetChatID(update),
+				err.Error()+"\nUsage: "+spec.usage(name),
+			))
+			return err
+		}
+		bot.withValue(update, commandArgsKey{}, v.Interface())
+		return f(bot, update)
+	}
+	return bot.RegisterCommand(name, handler, chatID, mw...)
+}
+
+// commandArguments returns text after command, even if message has no command entity
+func commandArguments(message *tgbotapi.Message) string {
+	if message.IsCommand() {
+		return message.CommandArguments()
+	}
+	text := strings.TrimSpace(message.Text)
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		return text[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type buyArgs struct {
+	Item  string   `arg:"item" required:"true"`
+	Count int      `arg:"count" default:"1"`
+	Notes []string `arg:"notes"`
+	Gift  bool     `flag:"gift"`
+	Price float64  `flag:"price" default:"9.99"`
+	Skip  string
+}
+
+func TestParseArgs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		text     string
+		expected buyArgs
+		err      error
+	}{
+		{
+			text:     "apple",
+			expected: buyArgs{Item: "apple", Count: 1, Price: 9.99},
+		},
+		{
+			text:     `"green apple" 3 for mom --gift --price 1.5`,
+			expected: buyArgs{Item: "green apple", Count: 3, Notes: []string{"for", "mom"}, Gift: true, Price: 1.5},
+		},
+		{
+			text:     "--price=2 apple 5 -- --gift",
+			expected: buyArgs{Item: "apple", Count: 5, Notes: []string{"--gift"}, Price: 2},
+		},
+		{text: "", err: InvalidArgsError},
+		{text: "apple many", err: InvalidArgsError},
+		{text: "apple --color red", err: InvalidArgsError},
+		{text: "apple --price", err: InvalidArgsError},
+		{text: `"apple`, err: InvalidArgsError},
+	}
+	for i, tc := range cases {
+		var args buyArgs
+		err := ParseArgs(tc.text, &args)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("case %d: expected %v, got %v", i, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+		} else if fmt.Sprintf("%+v", args) != fmt.Sprintf("%+v", tc.expected) {
+			t.Errorf("case %d: expected %+v, got %+v", i, tc.expected, args)
+		}
+	}
+
+	if err := ParseArgs("1", &struct {
+		C complex64 `arg:"c"`
+	}{}); err == nil || errors.Is(err, InvalidArgsError) {
+		t.Errorf("unsupported field type must be reported, got %v", err)
+	}
+}
+
+func TestArgsUsage(t *testing.T) {
+	t.Parallel()
+
+	usage, err := ArgsUsage("/buy", buyArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/buy <item> [count] [notes...] [--gift] [--price=<price>]"
+	if usage != expected {
+		t.Errorf("expected %q, got %q", expected, usage)
+	}
+}
+
+func TestBotFramework_RegisterCommandArgs(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	var got *buyArgs
+	err := bot.RegisterCommandArgs("/buy", buyArgs{}, func(bot *BotFramework, update *tgbotapi.Update) error {
+		got = CommandArgs(bot.Context(update)).(*buyArgs)
+		return nil
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: 123},
+		Text:     "/buy apple 2",
+		Entities: []tgbotapi.MessageEntity{{Offset: 0, Length: 4, Type: "bot_command"}},
+	}}
+	if err = bot.HandleUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Item != "apple" || got.Count != 2 {
+		t.Errorf("unexpected args %+v", got)
+	}
+
+	got = nil
+	u.Message.Text = "/buy"
+	if err = bot.HandleUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Error("handler must not be called with invalid args")
+	}
+}
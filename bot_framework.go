@@ -1,27 +1,90 @@
 package tgbot
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 var NoHandlersError = errors.New("no handlers for update")
 
+// PanicError is returned by HandleUpdate when handler panics
+type PanicError struct {
+	// Value is the value passed to panic
+	Value interface{}
+	// Stack is the stack trace of the panicked goroutine
+	Stack []byte
+	// Update is the update which caused panic
+	Update tgbotapi.Update
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while handling update %d: %v", e.Update.UpdateID, e.Value)
+}
+
 // CommonHandler is a short type alias for handler function
 type CommonHandler func(bot *BotFramework, update *tgbotapi.Update) error
 
 // BotFramework main object to work with. Instantiate using NewBotFramework
 type BotFramework struct {
+	// loops and inflight are accessed atomically and must be 64-bit aligned
+	loops    int64
+	inflight int64
+
 	tgbotapi.BotAPI
 	commands              map[string]map[int64]CommonHandler
 	handlers              map[string]map[int64]CommonHandler
-	callbackQueryHandlers map[string]map[int64]CommonHandler
-	inlineQueryHandlers   map[string]map[int64]CommonHandler
+	callbackQueryHandlers *prefixTree
+	inlineQueryHandlers   *inlineRouter
+	patterns              []*regexpRoute
+	middleware            []Middleware
+	contexts              sync.Map
+	shutdown              chan struct{}
+	shutdownOnce          sync.Once
+	abandon               chan struct{}
+	abandonOnce           sync.Once
 	mu                    sync.RWMutex
 	ErrorHandler          func(u tgbotapi.Update, err error)
+	// RouteEdited enables dispatch of edited messages to the same commands, patterns and media handlers
+	// as regular messages, if there is no handler registered with RegisterEditedMessageHandler
+	RouteEdited bool
+	// PreCheckoutTimeout limits time of pre-checkout query handler, DefaultPreCheckoutTimeout is used if it is 0
+	PreCheckoutTimeout time.Duration
+	// OnChatMigrate is called when group is upgraded to supergroup, after registrations are moved to the new chat ID.
+	// Telegram sends migration message to both chats, so it may be called twice for the same pair
+	OnChatMigrate func(oldChatID, newChatID int64)
+	// Sessions keeps data of BotFramework.Session, in-memory store is used by default
+	Sessions SessionStore
+	// Dispatch configures worker pool of HandleUpdates.
+	// Zero value runs every update in its own goroutine
+	Dispatch DispatchConfig
+
+	shippingQueryHandlers     *prefixTree
+	preCheckoutQueryHandlers  *prefixTree
+	successfulPaymentHandlers *prefixTree
+	preCheckoutAnswers        sync.Map
+
+	pollHandlers       map[string]CommonHandler
+	pollAnswerHandlers map[string]CommonHandler
+
+	chosenInlineResultHandlers *prefixTree
+
+	states        map[StateKey]string
+	stateHandlers map[string]CommonHandler
+	forms         map[string]*Form
+	formProgress  map[StateKey]*formProgress
+
+	waiters   map[int64][]*messageWaiter
+	waitersMu sync.Mutex
+
+	expiries map[expiryKey]expiry
+	sweeping bool
 }
 
 // NewBotFramework creates new bot instance
@@ -30,21 +93,54 @@ func NewBotFramework(api *tgbotapi.BotAPI) *BotFramework {
 		BotAPI:                *api,
 		commands:              make(map[string]map[int64]CommonHandler),
 		handlers:              make(map[string]map[int64]CommonHandler),
-		callbackQueryHandlers: make(map[string]map[int64]CommonHandler),
-		inlineQueryHandlers:   make(map[string]map[int64]CommonHandler),
-	}
-	bot.handlers["plain"] = make(map[int64]CommonHandler)
-	bot.handlers["photo"] = make(map[int64]CommonHandler)
-	bot.handlers["file"] = make(map[int64]CommonHandler)
-	bot.handlers["contact"] = make(map[int64]CommonHandler)
-	bot.handlers["sticker"] = make(map[int64]CommonHandler)
-	bot.handlers["audio"] = make(map[int64]CommonHandler)
-	bot.handlers["video"] = make(map[int64]CommonHandler)
-	bot.handlers["video_note"] = make(map[int64]CommonHandler)
-	bot.handlers["voice"] = make(map[int64]CommonHandler)
-	bot.handlers["location"] = make(map[int64]CommonHandler)
-	bot.handlers["venue"] = make(map[int64]CommonHandler)
-	bot.handlers["any"] = make(map[int64]CommonHandler)
+		callbackQueryHandlers: newPrefixTree(),
+		inlineQueryHandlers:   newInlineRouter(),
+		shutdown:              make(chan struct{}),
+		abandon:               make(chan struct{}),
+
+		shippingQueryHandlers:     newPrefixTree(),
+		preCheckoutQueryHandlers:  newPrefixTree(),
+		successfulPaymentHandlers: newPrefixTree(),
+
+		pollHandlers:       make(map[string]CommonHandler),
+		pollAnswerHandlers: make(map[string]CommonHandler),
+
+		chosenInlineResultHandlers: newPrefixTree(),
+
+		states:        make(map[StateKey]string),
+		stateHandlers: make(map[string]CommonHandler),
+		forms:         make(map[string]*Form),
+		formProgress:  make(map[StateKey]*formProgress),
+
+		waiters: make(map[int64][]*messageWaiter),
+
+		expiries: make(map[expiryKey]expiry),
+	}
+	bot.handlers[KindText] = make(map[int64]CommonHandler)
+	bot.handlers[KindPhoto] = make(map[int64]CommonHandler)
+	bot.handlers[KindFile] = make(map[int64]CommonHandler)
+	bot.handlers[KindContact] = make(map[int64]CommonHandler)
+	bot.handlers[KindSticker] = make(map[int64]CommonHandler)
+	bot.handlers[KindAudio] = make(map[int64]CommonHandler)
+	bot.handlers[KindVideo] = make(map[int64]CommonHandler)
+	bot.handlers[KindVideoNote] = make(map[int64]CommonHandler)
+	bot.handlers[KindVoice] = make(map[int64]CommonHandler)
+	bot.handlers[KindLocation] = make(map[int64]CommonHandler)
+	bot.handlers[KindVenue] = make(map[int64]CommonHandler)
+	bot.handlers[KindAnimation] = make(map[int64]CommonHandler)
+	bot.handlers[KindDice] = make(map[int64]CommonHandler)
+	bot.handlers[KindGame] = make(map[int64]CommonHandler)
+	bot.handlers[KindPoll] = make(map[int64]CommonHandler)
+	bot.handlers[KindInvoice] = make(map[int64]CommonHandler)
+	bot.handlers[KindNewChatMembers] = make(map[int64]CommonHandler)
+	bot.handlers[KindLeftChatMember] = make(map[int64]CommonHandler)
+	bot.handlers[KindPinnedMessage] = make(map[int64]CommonHandler)
+	bot.handlers[KindNewChatTitle] = make(map[int64]CommonHandler)
+	bot.handlers[KindMigration] = make(map[int64]CommonHandler)
+	bot.handlers[KindAny] = make(map[int64]CommonHandler)
+	bot.handlers["edited"] = make(map[int64]CommonHandler)
+	bot.handlers["chat_join_request"] = make(map[int64]CommonHandler)
+	bot.Sessions = NewMemorySessionStore()
 	bot.ErrorHandler = func(u tgbotapi.Update, err error) {
 		if bot.GetChatID(&u) > 0 {
 			_, _ = bot.Send(tgbotapi.NewMessage(
@@ -56,7 +152,7 @@ func NewBotFramework(api *tgbotapi.BotAPI) *BotFramework {
 	return &bot
 }
 
-// GetChatID returns chat ID from update message and callback query
+// GetChatID returns chat ID of update, 0 if update has no chat
 func (bot *BotFramework) GetChatID(update *tgbotapi.Update) int64 {
 	if update.Message != nil {
 		if update.Message.Chat != nil {
@@ -64,6 +160,36 @@ func (bot *BotFramework) GetChatID(update *tgbotapi.Update) int64 {
 		}
 	}
 
+	if update.EditedMessage != nil {
+		if update.EditedMessage.Chat != nil {
+			return update.EditedMessage.Chat.ID
+		}
+	}
+
+	if update.ChannelPost != nil {
+		if update.ChannelPost.Chat != nil {
+			return update.ChannelPost.Chat.ID
+		}
+	}
+
+	if update.EditedChannelPost != nil {
+		if update.EditedChannelPost.Chat != nil {
+			return update.EditedChannelPost.Chat.ID
+		}
+	}
+
+	if update.MyChatMember != nil {
+		return update.MyChatMember.Chat.ID
+	}
+
+	if update.ChatMember != nil {
+		return update.ChatMember.Chat.ID
+	}
+
+	if update.ChatJoinRequest != nil {
+		return update.ChatJoinRequest.Chat.ID
+	}
+
 	if update.CallbackQuery != nil {
 		if update.CallbackQuery.Message != nil {
 			return update.CallbackQuery.Message.Chat.ID
@@ -74,22 +200,168 @@ func (bot *BotFramework) GetChatID(update *tgbotapi.Update) int64 {
 }
 
 // HandleUpdates handles all updates from channel.
-// save for panics
+// Concurrency is controlled by Dispatch config.
+// Returns when channel is closed and all handlers are finished.
+// Safe for panics: panic in handler is passed to ErrorHandler as *PanicError
 func (bot *BotFramework) HandleUpdates(ch tgbotapi.UpdatesChannel) {
-	for update := range ch {
-		u := update
-		go func() {
-			err := bot.HandleUpdate(&u)
+	bot.HandleUpdatesContext(context.Background(), ch)
+}
+
+// HandleUpdatesContext works like HandleUpdates, but stops dispatch when ctx is cancelled.
+// ctx is passed to every handler, queued updates are skipped after cancellation.
+// Use Shutdown to stop it gracefully: it stops reading updates at once,
+// but HandleUpdatesContext returns only after running handlers are finished
+func (bot *BotFramework) HandleUpdatesContext(ctx context.Context, ch tgbotapi.UpdatesChannel) {
+	atomic.AddInt64(&bot.loops, 1)
+	defer atomic.AddInt64(&bot.loops, -1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-bot.abandon:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cfg := bot.Dispatch
+	d := newDispatcher(cfg, bot.shutdown)
+	defer d.stop()
+
+	queues := newChatQueues(cfg)
+
+	for {
+		var u tgbotapi.Update
+		select {
+		case <-ctx.Done():
+			return
+		case <-bot.shutdown:
+			return
+		case update, ok := <-ch:
+			if !ok {
+				return
+			}
+			u = update
+		}
+
+		// waiting handler may block its chat queue or worker, so update is intercepted before dispatch
+		var intercepted bool
+		err := bot.protect(&u, func() error {
+			intercepted = bot.intercept(&u)
+			return nil
+		})
+		if err != nil {
+			bot.ErrorHandler(u, err)
+		}
+		if intercepted {
+			continue
+		}
+
+		atomic.AddInt64(&bot.inflight, 1)
+		task := func() {
+			defer atomic.AddInt64(&bot.inflight, -1)
+			if ctx.Err() != nil {
+				return
+			}
+			err := bot.protect(&u, func() error {
+				return bot.route(ctx, &u)
+			})
 			if err != nil {
 				bot.ErrorHandler(u, err)
 			}
-		}()
+		}
+
+		key := bot.orderKey(&u)
+		ordered := cfg.OrderByChat && key != 0
+		submitted := false
+		if ordered {
+			idle, ok := queues.push(key, task)
+			if ok && !idle {
+				continue
+			}
+			if idle {
+				first := task
+				task = func() {
+					first()
+					queues.drain(key)
+				}
+				if submitted = d.submit(ctx, task); !submitted {
+					queues.discard(key)
+				}
+			}
+		} else {
+			submitted = d.submit(ctx, task)
+		}
+		if submitted {
+			continue
+		}
+
+		atomic.AddInt64(&bot.inflight, -1)
+		if ctx.Err() == nil && !bot.shuttingDown() && cfg.OnDrop != nil {
+			cfg.OnDrop(u)
+		}
 	}
 }
 
-// HandleUpdate handles single update from channel
+// HandleUpdate handles single update from channel.
+// Panic in handler is recovered and returned as *PanicError
 func (bot *BotFramework) HandleUpdate(update *tgbotapi.Update) error {
-	anyErr := bot.handle(update, "any")
+	return bot.HandleUpdateContext(context.Background(), update)
+}
+
+// HandleUpdateContext handles single update with given context.
+// ctx is available to handlers through Context method.
+// Panic in handler is recovered and returned as *PanicError
+func (bot *BotFramework) HandleUpdateContext(ctx context.Context, update *tgbotapi.Update) error {
+	return bot.protect(update, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if bot.intercept(update) {
+			return nil
+		}
+		return bot.route(ctx, update)
+	})
+}
+
+// protect runs f and returns panic in it as *PanicError
+func (bot *BotFramework) protect(update *tgbotapi.Update, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack(), Update: *update}
+		}
+	}()
+	return f()
+}
+
+// intercept does what must happen before update is queued or dispatched to handlers:
+// migrates chat registrations and passes message to WaitForMessage.
+// Returns true if update is consumed
+func (bot *BotFramework) intercept(update *tgbotapi.Update) bool {
+	bot.migrateOnUpdate(update)
+	return bot.deliverToWaiter(update)
+}
+
+// route dispatches update to handlers
+func (bot *BotFramework) route(ctx context.Context, update *tgbotapi.Update) error {
+	bot.contexts.Store(update, ctx)
+	defer bot.contexts.Delete(update)
+
+	// payment queries must be answered in time, so state and universal handlers can't take them
+	if update.ShippingQuery != nil {
+		return bot.handleShippingQuery(update)
+	}
+	if update.PreCheckoutQuery != nil {
+		return bot.handlePreCheckoutQuery(update)
+	}
+
+	stateErr := bot.handleState(update)
+	if stateErr == nil || !errors.Is(stateErr, NoHandlersError) {
+		return stateErr
+	}
+
+	anyErr := bot.handle(update, KindAny)
 	if anyErr == nil || !errors.Is(anyErr, NoHandlersError) {
 		return anyErr
 	}
@@ -100,36 +372,82 @@ func (bot *BotFramework) HandleUpdate(update *tgbotapi.Update) error {
 	if update.InlineQuery != nil {
 		return bot.handleInlineQuery(update)
 	}
+	if update.ChosenInlineResult != nil {
+		return bot.handleChosenInlineResult(update)
+	}
+	if update.MyChatMember != nil {
+		return bot.handleChatMemberUpdated(update, "my_chat_member", update.MyChatMember)
+	}
+	if update.ChatMember != nil {
+		return bot.handleChatMemberUpdated(update, "chat_member", update.ChatMember)
+	}
+	if update.ChatJoinRequest != nil {
+		return bot.handle(update, "chat_join_request")
+	}
+	if update.Poll != nil {
+		return bot.handlePoll(update)
+	}
+	if update.PollAnswer != nil {
+		return bot.handlePollAnswer(update)
+	}
+	if update.EditedMessage != nil {
+		return bot.handleEditedMessage(update)
+	}
+	if update.ChannelPost != nil {
+		return bot.handleChannelPost(update, "channel_post", update.ChannelPost)
+	}
+	if update.EditedChannelPost != nil {
+		bot.withValue(update, editedKey{}, true)
+		return bot.handleChannelPost(update, "edited_channel_post", update.EditedChannelPost)
+	}
 	if update.Message == nil {
 		return errors.New("no message")
 	}
 
-	switch {
-	case update.Message.Photo != nil:
-		return bot.handle(update, "photo")
-	case update.Message.Document != nil:
-		return bot.handle(update, "file")
-	case update.Message.Contact != nil:
-		return bot.handle(update, "contact")
-	case update.Message.Sticker != nil:
-		return bot.handle(update, "sticker")
-	case update.Message.Audio != nil:
-		return bot.handle(update, "audio")
-	case update.Message.Video != nil:
-		return bot.handle(update, "video")
-	case update.Message.VideoNote != nil:
-		return bot.handle(update, "video_note")
-	case update.Message.Voice != nil:
-		return bot.handle(update, "voice")
-	case update.Message.Location != nil:
-		return bot.handle(update, "location")
-	case update.Message.Venue != nil:
-		return bot.handle(update, "venue")
-	case update.Message.Text != "":
+	return bot.handleMessage(update)
+}
+
+// handleMessage dispatches update.Message by its type
+func (bot *BotFramework) handleMessage(update *tgbotapi.Update) error {
+	var err error
+	kind := messageKind(update.Message)
+	switch kind {
+	case "":
+		return nil
+	case KindText:
 		return bot.handleCommand(update)
+	case KindSuccessfulPayment:
+		err = bot.handleSuccessfulPayment(update)
+	case KindMigration:
+		err = bot.handleMigration(update)
+	default:
+		err = bot.handleKind(update, "", kind)
+	}
+	if errors.Is(err, NoHandlersError) && quietKinds[kind] {
+		return nil
+	}
+	return err
+}
+
+// handleChannelPost calls handler of channel post kind, falls back to KindAny handler.
+// event is "channel_post" or "edited_channel_post"
+func (bot *BotFramework) handleChannelPost(update *tgbotapi.Update, event string, post *tgbotapi.Message) error {
+	if kind := messageKind(post); kind != "" {
+		err := bot.handleKind(update, event+"/", kind)
+		if !errors.Is(err, NoHandlersError) {
+			return err
+		}
 	}
+	return bot.handle(update, event+"/"+KindAny)
+}
 
-	return nil
+// handleKind calls handler of prefix+kind, falls back to handler of more general kind from kindFallbacks
+func (bot *BotFramework) handleKind(update *tgbotapi.Update, prefix, kind string) error {
+	err := bot.handle(update, prefix+kind)
+	if fallback, ok := kindFallbacks[kind]; ok && errors.Is(err, NoHandlersError) {
+		return bot.handle(update, prefix+fallback)
+	}
+	return err
 }
 
 func (bot *BotFramework) handleCommand(update *tgbotapi.Update) error {
@@ -145,15 +463,21 @@ func (bot *BotFramework) handleCommand(update *tgbotapi.Update) error {
 	if commands, ok := bot.commands[key]; ok {
 		if command, ok := commands[chatID]; ok {
 			bot.mu.RUnlock()
-			return command(bot, update)
+			return bot.call(command, update)
 		} else if command, ok = commands[0]; ok {
 			bot.mu.RUnlock()
-			return command(bot, update)
+			return bot.call(command, update)
 		}
 	}
 
+	command, params, ok := bot.matchPattern(update.Message.Text, chatID)
 	bot.mu.RUnlock()
-	return bot.handle(update, "plain")
+
+	if ok {
+		bot.withValue(update, patternParamsKey{}, params)
+		return bot.call(command, update)
+	}
+	return bot.handle(update, KindText)
 }
 
 func (bot *BotFramework) handleCallbackQuery(update *tgbotapi.Update) error {
@@ -161,49 +485,30 @@ func (bot *BotFramework) handleCallbackQuery(update *tgbotapi.Update) error {
 	data := update.CallbackQuery.Data
 
 	bot.mu.RLock()
+	command, _, ok := bot.callbackQueryHandlers.match(data, chatID)
+	bot.mu.RUnlock()
 
-	for key := range bot.callbackQueryHandlers {
-		if len(key) > len(data) {
-			continue
-		}
-		if data[:len(key)] == key {
-			if command, ok := bot.callbackQueryHandlers[key][chatID]; ok {
-				bot.mu.RUnlock()
-				return command(bot, update)
-			} else if command, ok = bot.callbackQueryHandlers[key][0]; ok {
-				bot.mu.RUnlock()
-				return command(bot, update)
-			}
-		}
+	if ok {
+		return bot.call(command, update)
 	}
-
-	bot.mu.RUnlock()
 	return fmt.Errorf("%w: callback, chatID=%d, data=%s", NoHandlersError, chatID, data)
 }
 
-func (bot *BotFramework) handleInlineQuery(update *tgbotapi.Update) error {
-	userID := int64(update.InlineQuery.From.ID)
-	query := update.InlineQuery.Query
+func (bot *BotFramework) handleChosenInlineResult(update *tgbotapi.Update) error {
+	var userID int64
+	if update.ChosenInlineResult.From != nil {
+		userID = update.ChosenInlineResult.From.ID
+	}
+	resultID := update.ChosenInlineResult.ResultID
 
 	bot.mu.RLock()
+	command, _, ok := bot.chosenInlineResultHandlers.match(resultID, userID)
+	bot.mu.RUnlock()
 
-	for key := range bot.inlineQueryHandlers {
-		if len(query) > len(key) {
-			continue
-		}
-		if key[:len(query)] == query {
-			if command, ok := bot.inlineQueryHandlers[key][userID]; ok {
-				bot.mu.RUnlock()
-				return command(bot, update)
-			} else if command, ok = bot.inlineQueryHandlers[key][0]; ok {
-				bot.mu.RUnlock()
-				return command(bot, update)
-			}
-		}
+	if ok {
+		return bot.call(command, update)
 	}
-
-	bot.mu.RUnlock()
-	return fmt.Errorf("%w: inline, userID=%d, query=%s", NoHandlersError, userID, query)
+	return fmt.Errorf("%w: chosen inline result, userID=%d, resultID=%s", NoHandlersError, userID, resultID)
 }
 
 func (bot *BotFramework) handle(update *tgbotapi.Update, event string) error {
@@ -213,10 +518,10 @@ func (bot *BotFramework) handle(update *tgbotapi.Update, event string) error {
 
 	if command, ok := bot.handlers[event][chatID]; ok {
 		bot.mu.RUnlock()
-		return command(bot, update)
+		return bot.call(command, update)
 	} else if command, ok = bot.handlers[event][0]; ok {
 		bot.mu.RUnlock()
-		return command(bot, update)
+		return bot.call(command, update)
 	}
 
 	bot.mu.RUnlock()
@@ -1,6 +1,7 @@
 package tgbot
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,7 +9,12 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"path"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -33,8 +39,19 @@ func okHandler(w http.ResponseWriter, _ *http.Request) {
 	_ = json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: json.RawMessage(`{}`)})
 }
 
+// namedHandler returns handler which fails with its name, so tests can tell which handler was called
+func namedHandler(name string) CommonHandler {
+	return func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New(name)
+	}
+}
+
 func getBot(t *testing.T) BotFramework {
-	server := httptest.NewServer(http.HandlerFunc(okHandler))
+	return getBotWithHandler(t, okHandler)
+}
+
+func getBotWithHandler(t *testing.T, handler http.HandlerFunc) BotFramework {
+	server := httptest.NewServer(handler)
 	sURL, err := url.Parse(server.URL)
 	if err != nil {
 		t.Fatal(err)
@@ -388,3 +405,1176 @@ func TestRaceConditions(t *testing.T) {
 		go h()
 	}
 }
+
+func TestBotFramework_Use(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next CommonHandler) CommonHandler {
+			return func(bot *BotFramework, update *tgbotapi.Update) error {
+				calls = append(calls, name)
+				return next(bot, update)
+			}
+		}
+	}
+
+	bot.Use(trace("global 1"), trace("global 2"))
+	bot.RegisterCommand("/start", func(bot *BotFramework, update *tgbotapi.Update) error {
+		calls = append(calls, "handler")
+		return nil
+	}, 0, trace("local"))
+	bot.RegisterPhotoHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		calls = append(calls, "photo")
+		return nil
+	}, 0)
+
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123},
+		Text: "/start",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:  &tgbotapi.Chat{ID: 123},
+		Photo: []tgbotapi.PhotoSize{{}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"global 1", "global 2", "local", "handler", "global 1", "global 2", "photo"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestBotFramework_HandleUpdatePanic(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterCommand("panic", func(bot *BotFramework, update *tgbotapi.Update) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	}, 0)
+
+	u := &tgbotapi.Update{UpdateID: 42, Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123},
+		Text: "panic",
+	}}
+	err := bot.HandleUpdate(u)
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected *PanicError, got %v", err)
+	}
+	if panicErr.Update.UpdateID != 42 {
+		t.Error("panic error must carry the update")
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Error("panic error must carry the stack trace")
+	}
+
+	errs := make(chan error, 1)
+	bot.ErrorHandler = func(u tgbotapi.Update, err error) {
+		errs <- err
+	}
+	uc := make(chan tgbotapi.Update, 1)
+	uc <- *u
+	close(uc)
+	bot.HandleUpdates(uc)
+	if err = <-errs; !errors.As(err, &panicErr) {
+		t.Errorf("expected *PanicError in ErrorHandler, got %v", err)
+	}
+}
+
+func TestBotFramework_HandleUpdatesWorkerPool(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	const workers = 2
+	var mu sync.Mutex
+	running, maxRunning, handled := 0, 0, 0
+	release := make(chan struct{})
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		handled++
+		mu.Unlock()
+		return nil
+	}, 0)
+
+	var dropped int32
+	bot.Dispatch = DispatchConfig{
+		Workers:   workers,
+		QueueSize: 1,
+		Overflow:  Drop,
+		OnDrop: func(u tgbotapi.Update) {
+			atomic.AddInt32(&dropped, 1)
+		},
+	}
+
+	uc := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(uc)
+		close(done)
+	}()
+	for i := 0; i < 10; i++ {
+		uc <- tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: 123}, Text: "hello",
+		}}
+	}
+	close(uc)
+	close(release)
+	<-done
+
+	if maxRunning > workers {
+		t.Errorf("expected at most %d concurrent handlers, got %d", workers, maxRunning)
+	}
+	if int(dropped)+handled != 10 {
+		t.Errorf("every update must be either handled or dropped: handled=%d, dropped=%d", handled, dropped)
+	}
+	if dropped == 0 {
+		t.Error("updates must be dropped when queue is full")
+	}
+}
+
+func TestBotFramework_HandleUpdatesOrderByChat(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	var mu sync.Mutex
+	got := make(map[int64][]string)
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		if update.Message.Text == "1" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := bot.GetChatID(update)
+		got[chatID] = append(got[chatID], update.Message.Text)
+		return nil
+	}, 0)
+
+	bot.Dispatch = DispatchConfig{OrderByChat: true}
+
+	uc := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(uc)
+		close(done)
+	}()
+	for i := 1; i <= 5; i++ {
+		for _, chatID := range []int64{123, 456} {
+			uc <- tgbotapi.Update{Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: chatID}, Text: strconv.Itoa(i),
+			}}
+		}
+	}
+	close(uc)
+	<-done
+
+	for _, chatID := range []int64{123, 456} {
+		if fmt.Sprint(got[chatID]) != "[1 2 3 4 5]" {
+			t.Errorf("chat %d: updates handled out of order: %v", chatID, got[chatID])
+		}
+	}
+}
+
+func TestBotFramework_HandleUpdatesOrderByChatOverflow(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []string
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		if update.Message.Text == "1" {
+			<-release
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, update.Message.Text)
+		return nil
+	}, 0)
+
+	dropped := make(chan string, 10)
+	bot.Dispatch = DispatchConfig{
+		Workers:     1,
+		QueueSize:   1,
+		Overflow:    Drop,
+		OrderByChat: true,
+		OnDrop: func(u tgbotapi.Update) {
+			dropped <- u.Message.Text
+		},
+	}
+
+	uc := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(uc)
+		close(done)
+	}()
+	for i := 1; i <= 4; i++ {
+		uc <- tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: 123}, Text: strconv.Itoa(i),
+		}}
+	}
+	// "1" is running, "2" waits in backlog of the chat, the rest don't fit
+	for _, expected := range []string{"3", "4"} {
+		if text := <-dropped; text != expected {
+			t.Errorf("expected %s to be dropped, got %s", expected, text)
+		}
+	}
+	close(release)
+	close(uc)
+	<-done
+
+	if fmt.Sprint(handled) != "[1 2]" {
+		t.Errorf("unexpected handled updates %v", handled)
+	}
+}
+
+func TestBotFramework_HandleUpdatesOrderByChatNoStall(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	release := make(chan struct{})
+	handled := make(chan int64, 10)
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		if bot.GetChatID(update) == 1 {
+			<-release
+		}
+		handled <- bot.GetChatID(update)
+		return nil
+	}, 0)
+	bot.Dispatch = DispatchConfig{Workers: 4, OrderByChat: true}
+
+	uc := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(uc)
+		close(done)
+	}()
+	sent := make(chan struct{})
+	go func() {
+		for _, chatID := range []int64{1, 1, 1, 2} {
+			uc <- tgbotapi.Update{Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: chatID}, Text: "hello",
+			}}
+		}
+		close(sent)
+	}()
+
+	// backlog of chat 1 is full, but chat 2 must not wait for it
+	select {
+	case chatID := <-handled:
+		if chatID != 2 {
+			t.Errorf("expected update of chat 2, got chat %d", chatID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("busy chat blocks other chats")
+	}
+	close(release)
+	<-sent
+	close(uc)
+	<-done
+	if len(handled) != 3 {
+		t.Errorf("all updates of chat 1 must be handled, got %d", len(handled))
+	}
+}
+
+func TestBotFramework_HandleUpdateContext(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	type ctxKey struct{}
+	bot.RegisterCommand("/ctx", WithContext(func(ctx context.Context, bot *BotFramework, update *tgbotapi.Update) error {
+		if ctx.Value(ctxKey{}) != "value" {
+			return errors.New("context is not passed to handler")
+		}
+		return nil
+	}), 0)
+
+	u := &tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123},
+		Text: "/ctx",
+	}}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	if err := bot.HandleUpdateContext(ctx, u); err != nil {
+		t.Error(err)
+	}
+	if bot.Context(u) != context.Background() {
+		t.Error("context must be released after update is handled")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := bot.HandleUpdateContext(ctx, u); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context must stop dispatch, got %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdatesContext(ctx, make(chan tgbotapi.Update))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("HandleUpdatesContext must return after cancellation")
+	}
+}
+
+func TestBotFramework_Shutdown(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	bot.RegisterCommand("slow", WithContext(func(ctx context.Context, bot *BotFramework, update *tgbotapi.Update) error {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}), 0)
+
+	uc := make(chan tgbotapi.Update, 2)
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(uc)
+		close(done)
+	}()
+	uc <- tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123}, Text: "slow",
+	}}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	abandoned, err := bot.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if abandoned != 1 {
+		t.Errorf("expected 1 abandoned handler, got %d", abandoned)
+	}
+	<-done
+
+	abandoned, err = bot.Shutdown(context.Background())
+	if err != nil || abandoned != 0 {
+		t.Errorf("all handlers must be finished, got %d, %v", abandoned, err)
+	}
+}
+
+func TestBotFramework_ShutdownBlockedQueue(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+	var dropped int64
+	bot.Dispatch = DispatchConfig{Workers: 1, OnDrop: func(u tgbotapi.Update) {
+		atomic.AddInt64(&dropped, 1)
+	}}
+
+	release := make(chan struct{})
+	var handled int64
+	bot.RegisterCommand("slow", func(bot *BotFramework, update *tgbotapi.Update) error {
+		atomic.AddInt64(&handled, 1)
+		<-release
+		return nil
+	}, 0)
+
+	uc := make(chan tgbotapi.Update, 2)
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(uc)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		uc <- tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: 123}, Text: "slow",
+		}}
+	}
+
+	waitInflight := func(n int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt64(&bot.inflight) != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d updates in flight, got %d", n, atomic.LoadInt64(&bot.inflight))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// second update waits for the only worker
+	waitInflight(2)
+
+	stopped := make(chan struct{})
+	go func() {
+		bot.Shutdown(context.Background())
+		close(stopped)
+	}()
+	// waiting for queue is interrupted by Shutdown
+	waitInflight(1)
+	close(release)
+	<-stopped
+	<-done
+
+	if n := atomic.LoadInt64(&handled); n != 1 {
+		t.Errorf("expected 1 handled update, got %d", n)
+	}
+	if n := atomic.LoadInt64(&dropped); n != 0 {
+		t.Errorf("updates skipped on shutdown must not be reported as dropped, got %d", n)
+	}
+}
+
+func TestBotFramework_CallbackQueryLongestPrefix(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterCallbackQueryHandler(namedHandler("menu"), "menu_", 0)
+	bot.RegisterCallbackQueryHandler(namedHandler("settings"), "menu_settings_", 0)
+	bot.RegisterCallbackQueryHandler(namedHandler("settings 123"), "menu_settings_", 123)
+	bot.RegisterCallbackQueryHandler(namedHandler("lang 456"), "menu_settings_lang", 456)
+
+	cases := []struct {
+		data     string
+		chatID   int64
+		expected string
+	}{
+		{"menu_main", 123, "menu"},
+		{"menu_settings_lang", 0, "settings"},
+		{"menu_settings_lang", 123, "settings 123"},
+		{"menu_settings_lang", 456, "lang 456"},
+		{"menu_settings_lang", 789, "settings"},
+		{"menu_settings_", 789, "settings"},
+		{"menu_setting", 789, "menu"},
+	}
+	for i, tc := range cases {
+		for n := 0; n < 10; n++ {
+			err := bot.HandleUpdate(&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+				Data:    tc.data,
+				Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: tc.chatID}},
+			}})
+			if err == nil || err.Error() != tc.expected {
+				t.Fatalf("case %d: expected %q, got %v", i, tc.expected, err)
+			}
+		}
+	}
+
+	bot.UnregisterCallbackQueryHandler("menu_settings_", 0)
+	bot.UnregisterCallbackQueryHandler("menu_settings_", 123)
+	err := bot.HandleUpdate(&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		Data: "menu_settings_lang",
+	}})
+	if err == nil || err.Error() != "menu" {
+		t.Errorf("expected fallback to shorter prefix, got %v", err)
+	}
+}
+
+func TestBotFramework_InlineQueryRoutes(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	result := func(name string) CommonHandler {
+		return func(bot *BotFramework, update *tgbotapi.Update) error {
+			return fmt.Errorf("%s:%s", name, InlineQueryRest(bot.Context(update)))
+		}
+	}
+	for _, route := range []struct {
+		match   InlineMatch
+		pattern string
+		userID  int64
+		name    string
+	}{
+		{InlineExact, "help", 0, "exact"},
+		{InlinePrefix, "find ", 0, "find"},
+		{InlinePrefix, "find user ", 0, "find user"},
+		{InlinePrefix, "find ", 42, "find 42"},
+		{InlineRegexp, `^\d+`, 0, "number"},
+		{InlineAny, "", 0, "any"},
+	} {
+		if err := bot.RegisterInlineQueryRoute(result(route.name), route.match, route.pattern, route.userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bot.RegisterInlineQueryRoute(result("bad"), InlineRegexp, "(", 0); err == nil {
+		t.Error("invalid regexp must not be registered")
+	}
+
+	cases := []struct {
+		query    string
+		userID   int64
+		expected string
+	}{
+		{"help", 1, "exact:"},
+		{"help me", 1, "any:help me"},
+		{"find cats", 1, "find:cats"},
+		{"find cats", 42, "find 42:cats"},
+		{"find user bob", 1, "find user:bob"},
+		{"find user bob", 42, "find user:bob"},
+		{"123 apples", 1, "number: apples"},
+		{"", 1, "any:"},
+	}
+	for i, tc := range cases {
+		err := bot.HandleUpdate(&tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+			From:  &tgbotapi.User{ID: tc.userID},
+			Query: tc.query,
+		}})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	bot.UnregisterInlineQueryRoute(InlineAny, "", 0)
+	err := bot.HandleUpdate(&tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+		From:  &tgbotapi.User{ID: 1},
+		Query: "",
+	}})
+	if !errors.Is(err, NoHandlersError) {
+		t.Errorf("empty query must not match other handlers, got %v", err)
+	}
+}
+
+func TestBotFramework_RegisterPattern(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	order := regexp.MustCompile(`^order (?P<id>\d+)$`)
+	buy := regexp.MustCompile(`^/buy_(?P<item>\d+)`)
+	bot.RegisterPattern(order, func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("order " + PatternParams(bot.Context(update))["id"])
+	}, 0)
+	bot.RegisterPattern(buy, func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("buy " + PatternParams(bot.Context(update))["item"])
+	}, 123)
+	bot.RegisterCommand("order 1", func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("exact command")
+	}, 0)
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("plain")
+	}, 0)
+
+	cases := []struct {
+		text     string
+		chatID   int64
+		expected string
+	}{
+		{"order 12345", 1, "order 12345"},
+		{"order 1", 1, "exact command"},
+		{"order abc", 1, "plain"},
+		{"/buy_42", 123, "buy 42"},
+		{"/buy_42", 1, "plain"},
+	}
+	for i, tc := range cases {
+		err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: tc.chatID},
+			Text: tc.text,
+		}})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	bot.UnregisterPattern(order, 0)
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1},
+		Text: "order 12345",
+	}})
+	if err == nil || err.Error() != "plain" {
+		t.Errorf("pattern must be unregistered, got %v", err)
+	}
+}
+
+func TestBotFramework_EditedMessage(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterCommand("/start", func(bot *BotFramework, update *tgbotapi.Update) error {
+		return fmt.Errorf("start edited=%v", IsEdited(bot.Context(update)))
+	}, 0)
+
+	edited := &tgbotapi.Update{EditedMessage: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123},
+		Text: "/start",
+	}}
+	// unhandled edits must not be reported, default ErrorHandler would reply to the user
+	if err := bot.HandleUpdate(edited); err != nil {
+		t.Errorf("edited message must not be routed by default, got %v", err)
+	}
+	if id := bot.GetChatID(edited); id != 123 {
+		t.Errorf("expected chat ID 123 of edited message, got %d", id)
+	}
+
+	bot.RouteEdited = true
+	err := bot.HandleUpdate(edited)
+	if err == nil || err.Error() != "start edited=true" {
+		t.Errorf("edited message must be routed to command, got %v", err)
+	}
+	err = bot.HandleUpdate(&tgbotapi.Update{Message: edited.EditedMessage})
+	if err == nil || err.Error() != "start edited=false" {
+		t.Errorf("regular message must not be marked as edited, got %v", err)
+	}
+	err = bot.HandleUpdate(&tgbotapi.Update{EditedMessage: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123},
+		Text: "no handler for this text",
+	}})
+	if err != nil {
+		t.Errorf("unhandled routed edit must not be reported, got %v", err)
+	}
+
+	bot.RegisterEditedMessageHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("edited handler")
+	}, 123)
+	err = bot.HandleUpdate(edited)
+	if err == nil || err.Error() != "edited handler" {
+		t.Errorf("edited message handler must take precedence, got %v", err)
+	}
+}
+
+func TestBotFramework_ChannelPost(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	result := func(name string) CommonHandler {
+		return func(bot *BotFramework, update *tgbotapi.Update) error {
+			return fmt.Errorf("%s edited=%v", name, IsEdited(bot.Context(update)))
+		}
+	}
+	bot.RegisterChannelPostHandler(result("photo"), KindPhoto, -100123)
+	bot.RegisterChannelPostHandler(result("any"), KindAny, 0)
+	bot.RegisterEditedChannelPostHandler(result("edited text"), KindText, -100123)
+	if err := bot.RegisterChannelPostHandler(result("bad"), "gif", 0); err == nil {
+		t.Error("unknown kind must not be registered")
+	}
+
+	channel := &tgbotapi.Chat{ID: -100123, Type: "channel"}
+	cases := []struct {
+		update   *tgbotapi.Update
+		expected string
+	}{
+		{
+			update:   &tgbotapi.Update{ChannelPost: &tgbotapi.Message{Chat: channel, Photo: []tgbotapi.PhotoSize{{}}}},
+			expected: "photo edited=false",
+		},
+		{
+			update:   &tgbotapi.Update{ChannelPost: &tgbotapi.Message{Chat: channel, Text: "hello"}},
+			expected: "any edited=false",
+		},
+		{
+			update:   &tgbotapi.Update{EditedChannelPost: &tgbotapi.Message{Chat: channel, Text: "hello"}},
+			expected: "edited text edited=true",
+		},
+	}
+	for i, tc := range cases {
+		if id := bot.GetChatID(tc.update); id != channel.ID {
+			t.Errorf("case %d: expected chat ID %d, got %d", i, channel.ID, id)
+		}
+		err := bot.HandleUpdate(tc.update)
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	bot.UnregisterEditedChannelPostHandler(KindText, -100123)
+	if err := bot.HandleUpdate(cases[2].update); !errors.Is(err, NoHandlersError) {
+		t.Errorf("handler must be unregistered, got %v", err)
+	}
+}
+
+func TestBotFramework_ChatMemberHandlers(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterMyChatMemberHandler(namedHandler("added"), "left -> member", 0)
+	bot.RegisterMyChatMemberHandler(namedHandler("kicked"), "* -> kicked", 0)
+	bot.RegisterChatMemberHandler(namedHandler("promoted"), "member -> administrator", -100123)
+	bot.RegisterChatMemberHandler(namedHandler("any"), "", -100123)
+	if err := bot.RegisterChatMemberHandler(namedHandler("bad"), "member -> banned", 0); err == nil {
+		t.Error("unknown status must not be registered")
+	}
+
+	changed := func(from, to string) *tgbotapi.ChatMemberUpdated {
+		return &tgbotapi.ChatMemberUpdated{
+			Chat:          tgbotapi.Chat{ID: -100123},
+			OldChatMember: tgbotapi.ChatMember{Status: from},
+			NewChatMember: tgbotapi.ChatMember{Status: to},
+		}
+	}
+	cases := []struct {
+		update   *tgbotapi.Update
+		expected string
+	}{
+		{&tgbotapi.Update{MyChatMember: changed("left", "member")}, "added"},
+		{&tgbotapi.Update{MyChatMember: changed("administrator", "kicked")}, "kicked"},
+		{&tgbotapi.Update{ChatMember: changed("member", "administrator")}, "promoted"},
+		{&tgbotapi.Update{ChatMember: changed("member", "left")}, "any"},
+	}
+	for i, tc := range cases {
+		if id := bot.GetChatID(tc.update); id != -100123 {
+			t.Errorf("case %d: unexpected chat ID %d", i, id)
+		}
+		err := bot.HandleUpdate(tc.update)
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	unblocked := &tgbotapi.Update{MyChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat:          tgbotapi.Chat{ID: 55, Type: "private"},
+		OldChatMember: tgbotapi.ChatMember{Status: "kicked"},
+		NewChatMember: tgbotapi.ChatMember{Status: "member"},
+	}}
+	if err := bot.HandleUpdate(unblocked); err != nil {
+		t.Errorf("unhandled transition must not be reported, got %v", err)
+	}
+}
+
+func TestBotFramework_ChatJoinRequest(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan string, 1)
+	bot := getBotWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if path.Base(r.URL.Path) == "getMe" {
+			okHandler(w, r)
+			return
+		}
+		requests <- path.Base(r.URL.Path) + " " + r.Form.Get("chat_id") + " " + r.Form.Get("user_id")
+		okHandler(w, r)
+	})
+
+	bot.RegisterChatJoinRequestHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		if update.ChatJoinRequest.Bio == "spam" {
+			return bot.DeclineChatJoinRequest(update)
+		}
+		return bot.ApproveChatJoinRequest(update)
+	}, -100123)
+
+	u := &tgbotapi.Update{ChatJoinRequest: &tgbotapi.ChatJoinRequest{
+		Chat: tgbotapi.Chat{ID: -100123},
+		From: tgbotapi.User{ID: 42},
+	}}
+	if id := bot.GetChatID(u); id != -100123 {
+		t.Errorf("unexpected chat ID %d", id)
+	}
+	if err := bot.HandleUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-requests; req != "approveChatJoinRequest -100123 42" {
+		t.Errorf("unexpected request %q", req)
+	}
+
+	u.ChatJoinRequest.Bio = "spam"
+	if err := bot.HandleUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-requests; req != "declineChatJoinRequest -100123 42" {
+		t.Errorf("unexpected request %q", req)
+	}
+}
+
+func TestBotFramework_PollHandlers(t *testing.T) {
+	t.Parallel()
+
+	bot := getBotWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if path.Base(r.URL.Path) == "sendPoll" {
+			_ = json.NewEncoder(w).Encode(tgbotapi.APIResponse{
+				Ok:     true,
+				Result: json.RawMessage(`{"message_id":1,"poll":{"id":"quiz"}}`),
+			})
+			return
+		}
+		okHandler(w, r)
+	})
+
+	poll := tgbotapi.NewPoll(123, "2 + 2 = ?", "3", "4")
+	poll.IsAnonymous = false
+	_, err := bot.SendPoll(poll, func(bot *BotFramework, update *tgbotapi.Update) error {
+		return fmt.Errorf("answer %v", update.PollAnswer.OptionIDs)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.RegisterPollHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return fmt.Errorf("voters %d", update.Poll.TotalVoterCount)
+	}, "")
+
+	err = bot.HandleUpdate(&tgbotapi.Update{PollAnswer: &tgbotapi.PollAnswer{
+		PollID:    "quiz",
+		OptionIDs: []int{1},
+	}})
+	if err == nil || err.Error() != "answer [1]" {
+		t.Errorf("expected poll answer handler, got %v", err)
+	}
+
+	err = bot.HandleUpdate(&tgbotapi.Update{PollAnswer: &tgbotapi.PollAnswer{PollID: "other"}})
+	if !errors.Is(err, NoHandlersError) {
+		t.Errorf("expected no handlers error, got %v", err)
+	}
+
+	err = bot.HandleUpdate(&tgbotapi.Update{Poll: &tgbotapi.Poll{ID: "quiz", TotalVoterCount: 3}})
+	if err == nil || err.Error() != "voters 3" {
+		t.Errorf("expected poll handler, got %v", err)
+	}
+	if _, ok := bot.pollAnswerHandlers["quiz"]; !ok {
+		t.Error("answer handler of open poll must be kept")
+	}
+
+	err = bot.HandleUpdate(&tgbotapi.Update{Poll: &tgbotapi.Poll{ID: "quiz", TotalVoterCount: 4, IsClosed: true}})
+	if err == nil || err.Error() != "voters 4" {
+		t.Errorf("expected poll handler for closed poll, got %v", err)
+	}
+	if _, ok := bot.pollAnswerHandlers["quiz"]; ok {
+		t.Error("answer handler must be removed when poll is closed")
+	}
+	if _, ok := bot.pollHandlers[""]; !ok {
+		t.Error("handler for any poll must be kept")
+	}
+}
+
+func TestBotFramework_ChosenInlineResultHandlers(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterChosenInlineResultHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("article")
+	}, "article_", 0)
+	bot.RegisterChosenInlineResultHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("article 42")
+	}, "article_", 42)
+
+	cases := []struct {
+		resultID string
+		userID   int64
+		expected string
+	}{
+		{"article_1", 1, "article"},
+		{"article_1", 42, "article 42"},
+	}
+	for i, tc := range cases {
+		err := bot.HandleUpdate(&tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{
+			ResultID: tc.resultID,
+			From:     &tgbotapi.User{ID: tc.userID},
+		}})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	bot.UnregisterChosenInlineResultHandler("article_", 0)
+	err := bot.HandleUpdate(&tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{
+		ResultID: "article_1",
+		From:     &tgbotapi.User{ID: 1},
+	}})
+	if !errors.Is(err, NoHandlersError) {
+		t.Errorf("handler must be unregistered, got %v", err)
+	}
+}
+
+func TestBotFramework_ServiceMessageHandlers(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterNewChatMembersHandler(namedHandler("joined"), 0)
+	bot.RegisterLeftChatMemberHandler(namedHandler("left"), 0)
+	bot.RegisterPinnedMessageHandler(namedHandler("pinned"), -100)
+	bot.RegisterNewChatTitleHandler(namedHandler("title"), 0)
+	bot.RegisterMigrationHandler(namedHandler("migrated"), 0)
+
+	chat := &tgbotapi.Chat{ID: -100}
+	cases := []struct {
+		message  *tgbotapi.Message
+		expected string
+	}{
+		{&tgbotapi.Message{Chat: chat, NewChatMembers: []tgbotapi.User{{ID: 1}}}, "joined"},
+		{&tgbotapi.Message{Chat: chat, LeftChatMember: &tgbotapi.User{ID: 1}}, "left"},
+		{&tgbotapi.Message{Chat: chat, PinnedMessage: &tgbotapi.Message{Text: "hello"}}, "pinned"},
+		{&tgbotapi.Message{Chat: chat, NewChatTitle: "new title"}, "title"},
+		{&tgbotapi.Message{Chat: chat, MigrateToChatID: -100200}, "migrated"},
+	}
+	for i, tc := range cases {
+		err := bot.HandleUpdate(&tgbotapi.Update{Message: tc.message})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	// unhandled service messages must not be reported, default ErrorHandler would reply to the user
+	bot.UnregisterPinnedMessageHandler(-100)
+	private := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 55}, PinnedMessage: &tgbotapi.Message{Text: "hello"}}
+	if err := bot.HandleUpdate(&tgbotapi.Update{Message: private}); err != nil {
+		t.Errorf("unhandled pinned message must not be reported, got %v", err)
+	}
+}
+
+func TestBotFramework_MediaKinds(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterFileHandler(namedHandler("file"), 0)
+	bot.RegisterAnimationHandler(namedHandler("animation"), 0)
+	bot.RegisterDiceHandler(namedHandler("dice"), 0)
+	bot.RegisterGameHandler(namedHandler("game"), 0)
+	bot.RegisterPollMessageHandler(namedHandler("poll"), 0)
+	bot.RegisterInvoiceHandler(namedHandler("invoice"), 0)
+	bot.RegisterLocationHandler(namedHandler("location"), 0)
+	bot.RegisterVenueHandler(namedHandler("venue"), 0)
+
+	chat := &tgbotapi.Chat{ID: 123}
+	cases := []struct {
+		message  *tgbotapi.Message
+		expected string
+	}{
+		{&tgbotapi.Message{Chat: chat, Document: &tgbotapi.Document{}}, "file"},
+		{&tgbotapi.Message{Chat: chat, Document: &tgbotapi.Document{}, Animation: &tgbotapi.Animation{}}, "animation"},
+		{&tgbotapi.Message{Chat: chat, Dice: &tgbotapi.Dice{Emoji: "🎲", Value: 6}}, "dice"},
+		{&tgbotapi.Message{Chat: chat, Game: &tgbotapi.Game{}}, "game"},
+		{&tgbotapi.Message{Chat: chat, Poll: &tgbotapi.Poll{}}, "poll"},
+		{&tgbotapi.Message{Chat: chat, Invoice: &tgbotapi.Invoice{}}, "invoice"},
+		{&tgbotapi.Message{Chat: chat, Location: &tgbotapi.Location{}}, "location"},
+		{&tgbotapi.Message{Chat: chat, Location: &tgbotapi.Location{}, Venue: &tgbotapi.Venue{}}, "venue"},
+	}
+	for i, tc := range cases {
+		err := bot.HandleUpdate(&tgbotapi.Update{Message: tc.message})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	bot.UnregisterAnimationHandler(0)
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: cases[1].message})
+	if err == nil || err.Error() != "file" {
+		t.Errorf("animation must fall back to file handler, got %v", err)
+	}
+	bot.UnregisterVenueHandler(0)
+	err = bot.HandleUpdate(&tgbotapi.Update{Message: cases[7].message})
+	if err == nil || err.Error() != "location" {
+		t.Errorf("venue must fall back to location handler, got %v", err)
+	}
+	bot.RegisterChannelPostHandler(namedHandler("channel location"), KindLocation, 0)
+	err = bot.HandleUpdate(&tgbotapi.Update{ChannelPost: cases[7].message})
+	if err == nil || err.Error() != "channel location" {
+		t.Errorf("venue channel post must fall back to location handler, got %v", err)
+	}
+	bot.UnregisterDiceHandler(0)
+	if err = bot.HandleUpdate(&tgbotapi.Update{Message: cases[2].message}); err != nil {
+		t.Errorf("unhandled dice must not be reported, got %v", err)
+	}
+}
+
+func TestBotFramework_ChatMigration(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	const oldChatID, newChatID = -123, -100123
+	bot.RegisterCommand("/start", namedHandler("start"), oldChatID)
+	bot.RegisterPhotoHandler(namedHandler("photo"), oldChatID)
+	bot.RegisterPhotoHandler(namedHandler("new photo"), newChatID)
+	bot.RegisterCallbackQueryHandler(namedHandler("callback"), "menu_", oldChatID)
+	bot.RegisterPattern(regexp.MustCompile(`^order`), namedHandler("order"), oldChatID)
+	bot.RegisterMigrationHandler(namedHandler("migration"), oldChatID)
+
+	migrated := make(chan [2]int64, 2)
+	bot.OnChatMigrate = func(oldChatID, newChatID int64) {
+		migrated <- [2]int64{oldChatID, newChatID}
+	}
+
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:            &tgbotapi.Chat{ID: oldChatID},
+		MigrateToChatID: newChatID,
+	}})
+	if err == nil || err.Error() != "migration" {
+		t.Errorf("expected migration handler of old chat, got %v", err)
+	}
+	if ids := <-migrated; ids != [2]int64{oldChatID, newChatID} {
+		t.Errorf("unexpected OnChatMigrate arguments %v", ids)
+	}
+
+	chat := &tgbotapi.Chat{ID: newChatID}
+	cases := []struct {
+		update   *tgbotapi.Update
+		expected string
+	}{
+		{&tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, Text: "/start"}}, "start"},
+		{&tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, Text: "order 1"}}, "order"},
+		{&tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, Photo: []tgbotapi.PhotoSize{{}}}}, "new photo"},
+		{&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			Data:    "menu_1",
+			Message: &tgbotapi.Message{Chat: chat},
+		}}, "callback"},
+	}
+	for i, tc := range cases {
+		err := bot.HandleUpdate(tc.update)
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("case %d: expected %q, got %v", i, tc.expected, err)
+		}
+	}
+
+	err = bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: oldChatID},
+		Text: "/start",
+	}})
+	if !errors.Is(err, NoHandlersError) {
+		t.Errorf("handlers must be removed from old chat, got %v", err)
+	}
+}
+
+func TestBotFramework_ChatMigrationBeforeHandlers(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	const oldChatID, newChatID = -1, -100
+	var migrated int
+	bot.OnChatMigrate = func(oldChatID, newChatID int64) {
+		migrated++
+	}
+	bot.RegisterCommand("/x", namedHandler("x"), oldChatID)
+	// universal handler and state consume every update, migration must happen anyway
+	bot.RegisterUniversalHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	}, 0)
+	bot.RegisterStateHandler("busy", func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	})
+	bot.SetState(oldChatID, 0, "busy")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	replies := make(chan *tgbotapi.Message, 1)
+	go func() {
+		reply, err := bot.WaitForMessage(ctx, oldChatID, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		replies <- reply
+	}()
+	for waiting := false; !waiting; {
+		time.Sleep(time.Millisecond)
+		bot.waitersMu.Lock()
+		waiting = len(bot.waiters[oldChatID]) > 0
+		bot.waitersMu.Unlock()
+	}
+
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:            &tgbotapi.Chat{ID: oldChatID},
+		MigrateToChatID: newChatID,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 1 {
+		t.Errorf("OnChatMigrate must be called once, got %d", migrated)
+	}
+	if _, ok := bot.commands["/x"][newChatID]; !ok {
+		t.Error("command must be moved to the new chat")
+	}
+	if state := bot.GetState(newChatID, 0); state != "busy" {
+		t.Errorf("state must be moved to the new chat, got %q", state)
+	}
+
+	err = bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: newChatID},
+		Text: "hello",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := <-replies; reply == nil || reply.Text != "hello" {
+		t.Errorf("waiter must get message from the new chat, got %+v", reply)
+	}
+}
+
+func TestBotFramework_States(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	const chatID, userID = -100, 42
+	bot.RegisterStateHandler("ask_name", func(bot *BotFramework, update *tgbotapi.Update) error {
+		if update.Message.IsCommand() {
+			return NoHandlersError
+		}
+		bot.SetState(bot.GetChatID(update), bot.GetUserID(update), "ask_age")
+		return errors.New("name " + update.Message.Text)
+	})
+	bot.RegisterStateHandler("quiz", func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("quiz")
+	})
+	bot.RegisterCommand("/cancel", func(bot *BotFramework, update *tgbotapi.Update) error {
+		bot.ResetState(bot.GetChatID(update), bot.GetUserID(update))
+		return errors.New("cancelled")
+	}, 0)
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("plain")
+	}, 0)
+
+	message := func(userID int64, text string) *tgbotapi.Update {
+		u := &tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: chatID},
+			From: &tgbotapi.User{ID: userID},
+			Text: text,
+		}}
+		if text[0] == '/' {
+			u.Message.Entities = []tgbotapi.MessageEntity{{Offset: 0, Length: len(text), Type: "bot_command"}}
+		}
+		return u
+	}
+
+	bot.SetState(chatID, userID, "ask_name")
+	steps := []struct {
+		update   *tgbotapi.Update
+		expected string
+	}{
+		{message(userID, "/cancel"), "cancelled"},
+		{message(userID, "Bob"), "plain"},
+	}
+	for i, step := range steps {
+		err := bot.HandleUpdate(step.update)
+		if err == nil || err.Error() != step.expected {
+			t.Errorf("step %d: expected %q, got %v", i, step.expected, err)
+		}
+	}
+
+	bot.SetState(chatID, userID, "ask_name")
+	err := bot.HandleUpdate(message(userID, "Bob"))
+	if err == nil || err.Error() != "name Bob" {
+		t.Errorf("expected state handler, got %v", err)
+	}
+	if state := bot.GetState(chatID, userID); state != "ask_age" {
+		t.Errorf("expected state ask_age, got %q", state)
+	}
+	err = bot.HandleUpdate(message(userID, "42"))
+	if err == nil || err.Error() != "plain" {
+		t.Errorf("state without handler must fall back to regular handlers, got %v", err)
+	}
+
+	bot.SetState(chatID, 0, "quiz")
+	err = bot.HandleUpdate(message(7, "hello"))
+	if err == nil || err.Error() != "quiz" {
+		t.Errorf("expected chat state handler, got %v", err)
+	}
+
+	bot.MigrateChat(chatID, -100200)
+	if state := bot.GetState(-100200, userID); state != "ask_age" {
+		t.Errorf("state must be migrated, got %q", state)
+	}
+	if state := bot.GetState(chatID, 0); state != "" {
+		t.Errorf("state of old chat must be removed, got %q", state)
+	}
+}
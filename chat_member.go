@@ -0,0 +1,118 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatMemberStatuses lists statuses which can be used in transitions
+var chatMemberStatuses = map[string]bool{
+	"*":             true,
+	"creator":       true,
+	"administrator": true,
+	"member":        true,
+	"restricted":    true,
+	"left":          true,
+	"kicked":        true,
+}
+
+// parseTransition parses transition like "member -> kicked".
+// "*" matches any status, empty transition matches any change
+func parseTransition(transition string) (string, string, error) {
+	if strings.TrimSpace(transition) == "" {
+		return "*", "*", nil
+	}
+	parts := strings.Split(transition, "->")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("transition %q must look like \"old -> new\"", transition)
+	}
+	from, to := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	for _, status := range []string{from, to} {
+		if !chatMemberStatuses[status] {
+			return "", "", fmt.Errorf("unknown chat member status %q", status)
+		}
+	}
+	return from, to, nil
+}
+
+// RegisterMyChatMemberHandler binds handler for changes of the bot's own status in given chat,
+// e.g. when bot is added to a group or kicked from it.
+// If chatID = 0, handler will work in any chat
+// transition filters status changes: "member -> kicked", "left -> *", "* -> administrator".
+// Empty transition matches any change. Exact transitions take precedence over ones with "*"
+func (bot *BotFramework) RegisterMyChatMemberHandler(f CommonHandler, transition string, chatID int64, mw ...Middleware) error {
+	return bot.registerTransitionHandler("my_chat_member", f, transition, chatID, mw)
+}
+
+// UnregisterMyChatMemberHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterMyChatMemberHandler(transition string, chatID int64) error {
+	return bot.unregisterTransitionHandler("my_chat_member", transition, chatID)
+}
+
+// RegisterChatMemberHandler binds handler for status changes of chat members in given chat,
+// e.g. when user joins, leaves or gets promoted. Bot must be an administrator to receive them.
+// If chatID = 0, handler will work in any chat
+// transition filters status changes like in RegisterMyChatMemberHandler
+func (bot *BotFramework) RegisterChatMemberHandler(f CommonHandler, transition string, chatID int64, mw ...Middleware) error {
+	return bot.registerTransitionHandler("chat_member", f, transition, chatID, mw)
+}
+
+// UnregisterChatMemberHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterChatMemberHandler(transition string, chatID int64) error {
+	return bot.unregisterTransitionHandler("chat_member", transition, chatID)
+}
+
+func (bot *BotFramework) registerTransitionHandler(event string, f CommonHandler, transition string, chatID int64, mw []Middleware) error {
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	from, to, err := parseTransition(transition)
+	if err != nil {
+		return err
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	key := transitionEvent(event, from, to)
+	if _, ok := bot.handlers[key]; !ok {
+		bot.handlers[key] = make(map[int64]CommonHandler)
+	}
+	bot.handlers[key][chatID] = chain(f, mw)
+	return nil
+}
+
+func (bot *BotFramework) unregisterTransitionHandler(event string, transition string, chatID int64) error {
+	from, to, err := parseTransition(transition)
+	if err != nil {
+		return err
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[transitionEvent(event, from, to)], chatID)
+	return nil
+}
+
+func transitionEvent(event, from, to string) string {
+	return event + "/" + from + "->" + to
+}
+
+// handleChatMemberUpdated calls the most specific handler for status transition.
+// Unhandled transitions are not reported as errors: private chat updates would be replied to the user
+func (bot *BotFramework) handleChatMemberUpdated(update *tgbotapi.Update, event string, member *tgbotapi.ChatMemberUpdated) error {
+	from, to := member.OldChatMember.Status, member.NewChatMember.Status
+	for _, key := range []string{
+		transitionEvent(event, from, to),
+		transitionEvent(event, from, "*"),
+		transitionEvent(event, "*", to),
+		transitionEvent(event, "*", "*"),
+	} {
+		err := bot.handle(update, key)
+		if !errors.Is(err, NoHandlersError) {
+			return err
+		}
+	}
+	return nil
+}
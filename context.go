@@ -0,0 +1,35 @@
+package tgbot
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ContextHandler is a handler function which receives context of the update.
+// Use WithContext to register it
+type ContextHandler func(ctx context.Context, bot *BotFramework, update *tgbotapi.Update) error
+
+// WithContext adapts ContextHandler to CommonHandler, so it can be passed to any Register* method
+// For example:
+//
+//	bot.RegisterCommand("/report", tgbot.WithContext(SomeReportHandler), 0)
+func WithContext(f ContextHandler) CommonHandler {
+	return func(bot *BotFramework, update *tgbotapi.Update) error {
+		return f(bot.Context(update), bot, update)
+	}
+}
+
+// Context returns context of update being handled by HandleUpdateContext or HandleUpdatesContext.
+// Returns context.Background() for updates which are not being handled
+func (bot *BotFramework) Context(update *tgbotapi.Update) context.Context {
+	if ctx, ok := bot.contexts.Load(update); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+// withValue attaches key-value pair to context of update being handled
+func (bot *BotFramework) withValue(update *tgbotapi.Update, key, val interface{}) {
+	bot.contexts.Store(update, context.WithValue(bot.Context(update), key, val))
+}
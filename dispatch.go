@@ -0,0 +1,222 @@
+package tgbot
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// OverflowPolicy defines what HandleUpdates does with update when worker pool queue is full
+type OverflowPolicy int
+
+const (
+	// Block waits until there is free place in queue
+	Block OverflowPolicy = iota
+	// Drop skips update and passes it to DispatchConfig.OnDrop
+	Drop
+)
+
+// DispatchConfig controls how HandleUpdates runs handlers
+type DispatchConfig struct {
+	// Workers is max number of concurrently running handlers.
+	// If Workers = 0, every update is handled in its own goroutine
+	Workers int
+	// QueueSize is number of updates waiting for a free worker
+	QueueSize int
+	// Overflow defines what to do with update when queue is full
+	Overflow OverflowPolicy
+	// OnDrop is called for every update skipped with Drop policy
+	OnDrop func(u tgbotapi.Update)
+	// OrderByChat serializes updates from the same chat (or from the same user for inline queries),
+	// while different chats are still handled in parallel.
+	// Updates without chat are not ordered.
+	// Updates waiting for running handler of their chat never block other chats:
+	// with Drop policy every chat keeps at most QueueSize (at least one) waiting updates and drops the rest,
+	// with Block policy waiting updates of chat are not limited
+	OrderByChat bool
+}
+
+// shutdownPollInterval is how often Shutdown checks for running handlers
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully stops HandleUpdates: it stops consuming updates channel
+// and waits for running and queued handlers to finish.
+// If ctx is done first, contexts of remaining handlers are cancelled,
+// Shutdown returns number of abandoned updates and ctx error.
+// HandleUpdates stops reading updates as soon as Shutdown is called
+// and returns when its running and queued handlers are finished
+func (bot *BotFramework) Shutdown(ctx context.Context) (abandoned int, err error) {
+	bot.shutdownOnce.Do(func() { close(bot.shutdown) })
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if atomic.LoadInt64(&bot.loops) == 0 && atomic.LoadInt64(&bot.inflight) == 0 {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			abandoned = int(atomic.LoadInt64(&bot.inflight))
+			bot.abandonOnce.Do(func() { close(bot.abandon) })
+			return abandoned, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// shuttingDown reports whether Shutdown was called
+func (bot *BotFramework) shuttingDown() bool {
+	select {
+	case <-bot.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatcher runs tasks according to DispatchConfig
+type dispatcher struct {
+	cfg   DispatchConfig
+	tasks chan func()
+	wg    sync.WaitGroup
+	done  <-chan struct{} // closed on Shutdown, stops waiting for queue
+}
+
+func newDispatcher(cfg DispatchConfig, done <-chan struct{}) *dispatcher {
+	d := &dispatcher{cfg: cfg, done: done}
+	if cfg.Workers <= 0 {
+		return d
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	d.tasks = make(chan func(), queueSize)
+	d.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go func() {
+			defer d.wg.Done()
+			for task := range d.tasks {
+				task()
+			}
+		}()
+	}
+	return d
+}
+
+// submit schedules task. Returns false if task was dropped, ctx is done or Shutdown is called while waiting for queue
+func (d *dispatcher) submit(ctx context.Context, task func()) bool {
+	if d.tasks == nil {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			task()
+		}()
+		return true
+	}
+
+	if d.cfg.Overflow == Drop {
+		select {
+		case d.tasks <- task:
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case d.tasks <- task:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-d.done:
+		return false
+	}
+}
+
+// stop waits for all submitted tasks. submit must not be called after stop
+func (d *dispatcher) stop() {
+	if d.tasks != nil {
+		close(d.tasks)
+	}
+	d.wg.Wait()
+}
+
+// chatQueues keeps tasks waiting for previous task from the same chat
+type chatQueues struct {
+	mu     sync.Mutex
+	queues map[int64][]func()
+	limit  int // max backlog of chat, -1 means unbounded
+}
+
+// newChatQueues creates queues for cfg. Backlog of chat is bounded only with Drop policy of worker pool:
+// waiting for one chat would stall all other chats, so with Block policy updates are parked in backlog
+func newChatQueues(cfg DispatchConfig) *chatQueues {
+	q := &chatQueues{
+		queues: make(map[int64][]func()),
+		limit:  -1,
+	}
+	if cfg.Workers > 0 && cfg.Overflow == Drop {
+		q.limit = cfg.QueueSize
+		if q.limit < 1 {
+			q.limit = 1
+		}
+	}
+	return q
+}
+
+// push marks chat busy or appends task to its backlog, it never waits.
+// Returns idle = true if chat was idle: task is not queued and caller must run it and drain the queue after it.
+// Returns ok = false if backlog is full and task is rejected
+func (q *chatQueues) push(key int64, task func()) (idle bool, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queue, busy := q.queues[key]
+	if !busy {
+		q.queues[key] = nil
+		return true, true
+	}
+	if q.limit >= 0 && len(queue) >= q.limit {
+		return false, false
+	}
+	q.queues[key] = append(queue, task)
+	return false, true
+}
+
+// drain runs queued tasks of chat one by one until queue is empty
+func (q *chatQueues) drain(key int64) {
+	for {
+		q.mu.Lock()
+		queue := q.queues[key]
+		if len(queue) == 0 {
+			delete(q.queues, key)
+			q.mu.Unlock()
+			return
+		}
+		task := queue[0]
+		queue[0] = nil
+		q.queues[key] = queue[1:]
+		q.mu.Unlock()
+
+		task()
+	}
+}
+
+// discard forgets idle queue which drain was not scheduled for
+func (q *chatQueues) discard(key int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.queues, key)
+}
+
+// orderKey returns key used to serialize updates: chat ID or user ID for inline queries
+func (bot *BotFramework) orderKey(update *tgbotapi.Update) int64 {
+	if update.InlineQuery != nil && update.InlineQuery.From != nil {
+		return int64(update.InlineQuery.From.ID)
+	}
+	return bot.GetChatID(update)
+}
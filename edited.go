@@ -0,0 +1,47 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type editedKey struct{}
+
+// IsEdited reports whether handler is called for edited message
+// For example:
+//
+//	if tgbot.IsEdited(bot.Context(update)) {
+//		// message was edited
+//	}
+func IsEdited(ctx context.Context) bool {
+	edited, _ := ctx.Value(editedKey{}).(bool)
+	return edited
+}
+
+// handleEditedMessage calls edited message handler of the chat.
+// If there is no such handler and RouteEdited is set, edited message is dispatched like a regular one:
+// handler receives a copy of update with Message set to the edited message.
+// Unhandled edited messages are not reported as errors, so users aren't notified about every edit
+func (bot *BotFramework) handleEditedMessage(update *tgbotapi.Update) error {
+	bot.withValue(update, editedKey{}, true)
+
+	err := bot.handle(update, "edited")
+	if !errors.Is(err, NoHandlersError) {
+		return err
+	}
+	if !bot.RouteEdited {
+		return nil
+	}
+
+	edited := *update
+	edited.Message = update.EditedMessage
+	bot.contexts.Store(&edited, bot.Context(update))
+	defer bot.contexts.Delete(&edited)
+
+	if err = bot.handleMessage(&edited); errors.Is(err, NoHandlersError) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package tgbot
+
+import (
+	"runtime/debug"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// expirySweepInterval is how often expired handlers are removed
+const expirySweepInterval = time.Second
+
+// ExpireHandler is called after temporary handler registered for chat is removed, e.g. to notify user.
+// It runs in its own goroutine, panic in it is passed to ErrorHandler as *PanicError
+type ExpireHandler func(bot *BotFramework, chatID int64)
+
+// Kinds of registrations which can expire
+const (
+	expiryCommand       = "command"
+	expiryPlainText     = "plain"
+	expiryCallbackQuery = "callback"
+)
+
+// expiryKey identifies temporary registration
+type expiryKey struct {
+	kind   string
+	key    string
+	chatID int64
+}
+
+type expiry struct {
+	deadline time.Time
+	onExpire ExpireHandler
+}
+
+// RegisterCommandTTL works like RegisterCommand, but handler is removed after ttl.
+// onExpire is optional and is called after removal.
+// Registering or unregistering the same command for the same chat cancels expiration.
+// Expired handlers are removed by background sweeper within a second,
+// sweeper runs only while there are registrations waiting for expiration.
+// Use time.Until to register handler until deadline
+// For example:
+//
+//	bot.RegisterCommandTTL("/confirm", ConfirmHandler, chatID, 5*time.Minute, func(bot *tgbot.BotFramework, chatID int64) {
+//		bot.Send(tgbotapi.NewMessage(chatID, "Confirmation timed out"))
+//	})
+func (bot *BotFramework) RegisterCommandTTL(name string, f CommonHandler, chatID int64, ttl time.Duration, onExpire ExpireHandler, mw ...Middleware) error {
+	if err := bot.RegisterCommand(name, f, chatID, mw...); err != nil {
+		return err
+	}
+	bot.expireAfter(expiryKey{kind: expiryCommand, key: name, chatID: chatID}, ttl, onExpire)
+	return nil
+}
+
+// RegisterPlainTextHandlerTTL works like RegisterPlainTextHandler, but handler is removed after ttl.
+// Expiration works the same way as in RegisterCommandTTL
+func (bot *BotFramework) RegisterPlainTextHandlerTTL(f CommonHandler, chatID int64, ttl time.Duration, onExpire ExpireHandler, mw ...Middleware) error {
+	if err := bot.RegisterPlainTextHandler(f, chatID, mw...); err != nil {
+		return err
+	}
+	bot.expireAfter(expiryKey{kind: expiryPlainText, chatID: chatID}, ttl, onExpire)
+	return nil
+}
+
+// RegisterCallbackQueryHandlerTTL works like RegisterCallbackQueryHandler, but handler is removed after ttl.
+// Expiration works the same way as in RegisterCommandTTL
+func (bot *BotFramework) RegisterCallbackQueryHandlerTTL(f CommonHandler, dataStartsWith string, chatID int64, ttl time.Duration, onExpire ExpireHandler, mw ...Middleware) error {
+	if err := bot.RegisterCallbackQueryHandler(f, dataStartsWith, chatID, mw...); err != nil {
+		return err
+	}
+	bot.expireAfter(expiryKey{kind: expiryCallbackQuery, key: dataStartsWith, chatID: chatID}, ttl, onExpire)
+	return nil
+}
+
+// expireAfter schedules removal of registration and starts sweeper if it's not running
+func (bot *BotFramework) expireAfter(key expiryKey, ttl time.Duration, onExpire ExpireHandler) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.expiries[key] = expiry{deadline: time.Now().Add(ttl), onExpire: onExpire}
+	if !bot.sweeping {
+		bot.sweeping = true
+		go bot.sweepExpiries()
+	}
+}
+
+// sweepExpiries removes expired handlers until there are no registrations with ttl left
+func (bot *BotFramework) sweepExpiries() {
+	ticker := time.NewTicker(expirySweepInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		bot.removeExpired(now)
+
+		bot.mu.Lock()
+		if len(bot.expiries) == 0 {
+			bot.sweeping = false
+			bot.mu.Unlock()
+			return
+		}
+		bot.mu.Unlock()
+	}
+}
+
+// removeExpired removes handlers with deadline before now and starts their onExpire
+func (bot *BotFramework) removeExpired(now time.Time) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	for key, e := range bot.expiries {
+		if now.Before(e.deadline) {
+			continue
+		}
+		switch key.kind {
+		case expiryCommand:
+			delete(bot.commands[key.key], key.chatID)
+		case expiryPlainText:
+			delete(bot.handlers[KindText], key.chatID)
+		case expiryCallbackQuery:
+			bot.callbackQueryHandlers.remove(key.key, key.chatID)
+		}
+		delete(bot.expiries, key)
+		if e.onExpire != nil {
+			// slow callback must not delay other expirations
+			go bot.runExpireHandler(e.onExpire, key.chatID)
+		}
+	}
+}
+
+// runExpireHandler calls onExpire and passes its panic to ErrorHandler
+func (bot *BotFramework) runExpireHandler(onExpire ExpireHandler, chatID int64) {
+	update := tgbotapi.Update{}
+	defer func() {
+		if r := recover(); r != nil {
+			bot.ErrorHandler(update, &PanicError{Value: r, Stack: debug.Stack(), Update: update})
+		}
+	}()
+	onExpire(bot, chatID)
+}
+
+// migrateExpiries moves expiration of handlers migrated from old chat to new one.
+// Must be called before handlers are migrated. Caller must hold bot.mu
+func (bot *BotFramework) migrateExpiries(oldChatID, newChatID int64) {
+	for key, e := range bot.expiries {
+		if key.chatID != oldChatID {
+			continue
+		}
+		delete(bot.expiries, key)
+
+		var exists bool
+		switch key.kind {
+		case expiryCommand:
+			_, exists = bot.commands[key.key][newChatID]
+		case expiryPlainText:
+			_, exists = bot.handlers[KindText][newChatID]
+		case expiryCallbackQuery:
+			exists = bot.callbackQueryHandlers.has(key.key, newChatID)
+		}
+		if !exists {
+			key.chatID = newChatID
+			bot.expiries[key] = e
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestBotFramework_RegisterTTL(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+	handler := func(bot *BotFramework, update *tgbotapi.Update) error { return nil }
+
+	expired := make(chan int64, 10)
+	onExpire := func(bot *BotFramework, chatID int64) {
+		expired <- chatID
+	}
+	if err := bot.RegisterCommandTTL("/confirm", handler, 1, time.Hour, onExpire); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.RegisterPlainTextHandlerTTL(handler, 2, time.Hour, onExpire); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.RegisterCallbackQueryHandlerTTL(handler, "vote_", 3, time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.RegisterCommandTTL("/confirm", handler, 4, time.Hour, onExpire); err != nil {
+		t.Fatal(err)
+	}
+	// regular registration cancels expiration
+	if err := bot.RegisterCommand("/confirm", handler, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// sweeper runs in background, so bot state is read under lock
+	expiries := func() int {
+		bot.mu.RLock()
+		defer bot.mu.RUnlock()
+		return len(bot.expiries)
+	}
+
+	bot.removeExpired(time.Now())
+	if n := expiries(); n != 3 {
+		t.Fatalf("handlers must not expire before ttl, %d left", n)
+	}
+
+	bot.removeExpired(time.Now().Add(2 * time.Hour))
+	if n := expiries(); n != 0 {
+		t.Errorf("all handlers must expire, %d left", n)
+	}
+	got := make(map[int64]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case chatID := <-expired:
+			got[chatID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("onExpire is not called")
+		}
+	}
+	if !got[1] || !got[2] {
+		t.Errorf("unexpected expired chats %v", got)
+	}
+	bot.mu.RLock()
+	_, expiredCommand := bot.commands["/confirm"][1]
+	_, keptCommand := bot.commands["/confirm"][4]
+	_, expiredText := bot.handlers[KindText][2]
+	bot.mu.RUnlock()
+	if expiredCommand {
+		t.Error("command must be removed")
+	}
+	if !keptCommand {
+		t.Error("command registered without ttl must be kept")
+	}
+	if expiredText {
+		t.Error("plain text handler must be removed")
+	}
+	err := bot.HandleUpdate(&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 3}},
+		Data:    "vote_1",
+	}})
+	if !errors.Is(err, NoHandlersError) {
+		t.Errorf("callback query handler must be removed, got %v", err)
+	}
+}
+
+func TestBotFramework_ExpirySweeper(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	expired := make(chan int64, 1)
+	err := bot.RegisterPlainTextHandlerTTL(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	}, -100, time.Millisecond, func(bot *BotFramework, chatID int64) {
+		expired <- chatID
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.MigrateChat(-100, -200)
+
+	select {
+	case chatID := <-expired:
+		if chatID != -200 {
+			t.Errorf("expected expiration of migrated chat, got %d", chatID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler didn't expire")
+	}
+}
+
+func TestBotFramework_ExpiryAfterShutdown(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+	if _, err := bot.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	bot.ErrorHandler = func(u tgbotapi.Update, err error) {
+		errs <- err
+	}
+	err := bot.RegisterCommandTTL("/confirm", func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	}, 1, time.Millisecond, func(bot *BotFramework, chatID int64) {
+		panic("notify failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "notify failed" {
+			t.Errorf("expected panic of onExpire, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler registered after Shutdown didn't expire")
+	}
+	bot.mu.RLock()
+	_, ok := bot.commands["/confirm"][1]
+	bot.mu.RUnlock()
+	if ok {
+		t.Error("expired command must be removed")
+	}
+}
@@ -0,0 +1,265 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Default form texts
+const (
+	DefaultFormCancelCommand = "cancel"
+	DefaultFormBackCommand   = "back"
+	DefaultFormInvalidInput  = "Unexpected answer, please try again"
+)
+
+// formStatePrefix is prepended to form name to get conversation state of the form
+const formStatePrefix = "form:"
+
+// FormAnswers holds messages answered to form steps by step name
+type FormAnswers map[string]*tgbotapi.Message
+
+// FormStep is a single question of Form
+type FormStep struct {
+	// Name is key of the answer in FormAnswers
+	Name string
+	// Prompt is text sent to ask for the answer
+	Prompt string
+	// ReplyMarkup is optional keyboard sent with the prompt, e.g. button requesting contact or location
+	ReplyMarkup interface{}
+	// Kind is expected kind of the answer message: KindText, KindContact, KindPhoto, KindLocation, etc.
+	// KindText is used by default
+	Kind string
+	// Validate checks the answer. Text of returned error is sent to user followed by prompt
+	Validate func(message *tgbotapi.Message) error
+}
+
+// Form describes wizard which asks user several questions one by one, see RegisterForm
+type Form struct {
+	Steps []FormStep
+	// OnComplete is called with all answers after the last step
+	OnComplete func(bot *BotFramework, update *tgbotapi.Update, answers FormAnswers) error
+	// OnCancel is called when user cancels the form, optional
+	OnCancel CommonHandler
+	// CancelCommand stops the form, DefaultFormCancelCommand is used by default
+	CancelCommand string
+	// BackCommand returns to previous step, DefaultFormBackCommand is used by default
+	BackCommand string
+	// InvalidInput is sent when answer has unexpected kind, DefaultFormInvalidInput is used by default
+	InvalidInput string
+}
+
+// formProgress keeps current step and answers of user who fills the form
+type formProgress struct {
+	name    string
+	step    int
+	answers FormAnswers
+}
+
+// RegisterForm binds form to given name, so it can be started with StartForm.
+// Form is built on conversation states: state of the user is "form:<name>" until form is completed or cancelled.
+// Commands other than cancel and back are dispatched as usual while form is active
+// For example:
+//
+//	bot.RegisterForm("signup", &tgbot.Form{
+//		Steps: []tgbot.FormStep{
+//			{Name: "name", Prompt: "What is your name?"},
+//			{Name: "phone", Prompt: "Send your contact", Kind: tgbot.KindContact},
+//		},
+//		OnComplete: SignupHandler,
+//	})
+//	bot.StartForm("signup", chatID, userID)
+func (bot *BotFramework) RegisterForm(name string, form *Form, mw ...Middleware) error {
+	if name == "" {
+		return errors.New("form name must not be empty")
+	}
+	if form == nil || len(form.Steps) == 0 {
+		return errors.New("form must have steps")
+	}
+	if form.OnComplete == nil {
+		return errors.New("form must have OnComplete handler")
+	}
+	names := make(map[string]bool, len(form.Steps))
+	for i, step := range form.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("step %d has no name", i)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("step name %q is not unique", step.Name)
+		}
+		names[step.Name] = true
+		if step.Kind != "" && (!messageKinds[step.Kind] || step.Kind == KindAny) {
+			return fmt.Errorf("step %q has invalid kind %q", step.Name, step.Kind)
+		}
+	}
+
+	handler := func(bot *BotFramework, update *tgbotapi.Update) error {
+		return bot.handleForm(name, form, update)
+	}
+	if err := bot.RegisterStateHandler(formStatePrefix+name, handler, mw...); err != nil {
+		return err
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.forms[name] = form
+	return nil
+}
+
+// UnregisterForm deletes form with given name. Users who fill the form are not affected until their next message
+func (bot *BotFramework) UnregisterForm(name string) error {
+	bot.mu.Lock()
+	delete(bot.forms, name)
+	bot.mu.Unlock()
+	return bot.UnregisterStateHandler(formStatePrefix + name)
+}
+
+// StartForm starts form for user in chat and sends prompt of the first step.
+// If userID = 0, the form is filled by the whole chat
+func (bot *BotFramework) StartForm(name string, chatID, userID int64) error {
+	bot.mu.Lock()
+	form, ok := bot.forms[name]
+	if !ok {
+		bot.mu.Unlock()
+		return fmt.Errorf("form %q is not registered", name)
+	}
+	key := StateKey{ChatID: chatID, UserID: userID}
+	bot.states[key] = formStatePrefix + name
+	bot.formProgress[key] = &formProgress{name: name, answers: make(FormAnswers)}
+	bot.mu.Unlock()
+
+	return bot.sendFormPrompt(chatID, form.Steps[0], "")
+}
+
+// CancelForm stops form filled by user in chat without calling OnCancel
+func (bot *BotFramework) CancelForm(chatID, userID int64) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	key := StateKey{ChatID: chatID, UserID: userID}
+	if _, ok := bot.formProgress[key]; ok {
+		delete(bot.formProgress, key)
+		delete(bot.states, key)
+	}
+}
+
+// handleForm processes answer to the current step of the form
+func (bot *BotFramework) handleForm(name string, form *Form, update *tgbotapi.Update) error {
+	message := update.Message
+	if message == nil {
+		return fmt.Errorf("%w: form %s expects messages", NoHandlersError, name)
+	}
+	chatID := message.Chat.ID
+
+	bot.mu.Lock()
+	key, progress := bot.findFormProgress(chatID, bot.GetUserID(update), name)
+	if progress == nil {
+		bot.mu.Unlock()
+		return fmt.Errorf("%w: form %s is not started in chat %d", NoHandlersError, name, chatID)
+	}
+	step := progress.step
+	bot.mu.Unlock()
+
+	if message.IsCommand() {
+		switch message.Command() {
+		case formCommand(form.CancelCommand, DefaultFormCancelCommand):
+			bot.CancelForm(key.ChatID, key.UserID)
+			if form.OnCancel != nil {
+				return form.OnCancel(bot, update)
+			}
+			return nil
+		case formCommand(form.BackCommand, DefaultFormBackCommand):
+			bot.mu.Lock()
+			if !bot.formAt(key, progress, step) {
+				bot.mu.Unlock()
+				return nil
+			}
+			if progress.step > 0 {
+				progress.step--
+				delete(progress.answers, form.Steps[progress.step].Name)
+			}
+			step = progress.step
+			bot.mu.Unlock()
+			return bot.sendFormPrompt(chatID, form.Steps[step], "")
+		default:
+			return fmt.Errorf("%w: command %s in form %s", NoHandlersError, message.Command(), name)
+		}
+	}
+
+	current := form.Steps[step]
+	kind := current.Kind
+	if kind == "" {
+		kind = KindText
+	}
+	if messageKind(message) != kind {
+		invalid := form.InvalidInput
+		if invalid == "" {
+			invalid = DefaultFormInvalidInput
+		}
+		return bot.sendFormPrompt(chatID, current, invalid)
+	}
+	if current.Validate != nil {
+		if err := current.Validate(message); err != nil {
+			return bot.sendFormPrompt(chatID, current, err.Error())
+		}
+	}
+
+	bot.mu.Lock()
+	// another answer could be handled while this one was validated, then this answer is stale
+	if !bot.formAt(key, progress, step) {
+		bot.mu.Unlock()
+		return nil
+	}
+	progress.answers[current.Name] = message
+	progress.step++
+	step = progress.step
+	var answers FormAnswers
+	if step == len(form.Steps) {
+		answers = progress.answers
+		delete(bot.formProgress, key)
+		delete(bot.states, key)
+	}
+	bot.mu.Unlock()
+
+	if answers != nil {
+		return form.OnComplete(bot, update, answers)
+	}
+	return bot.sendFormPrompt(chatID, form.Steps[step], "")
+}
+
+// findFormProgress returns progress of form for user in chat, then for the whole chat.
+// Caller must hold bot.mu
+func (bot *BotFramework) findFormProgress(chatID, userID int64, name string) (StateKey, *formProgress) {
+	for _, key := range []StateKey{{ChatID: chatID, UserID: userID}, {ChatID: chatID}} {
+		if progress, ok := bot.formProgress[key]; ok && progress.name == name {
+			return key, progress
+		}
+	}
+	return StateKey{}, nil
+}
+
+// formAt reports whether progress is still active for key and is at given step.
+// Caller must hold bot.mu
+func (bot *BotFramework) formAt(key StateKey, progress *formProgress, step int) bool {
+	return bot.formProgress[key] == progress && progress.step == step
+}
+
+// sendFormPrompt sends prompt of the step, preceded by error text if it's not empty
+func (bot *BotFramework) sendFormPrompt(chatID int64, step FormStep, errText string) error {
+	text := step.Prompt
+	if errText != "" {
+		text = errText + "\n" + text
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	if step.ReplyMarkup != nil {
+		msg.ReplyMarkup = step.ReplyMarkup
+	}
+	_, err := bot.Send(msg)
+	return err
+}
+
+func formCommand(command, def string) string {
+	if command == "" {
+		return def
+	}
+	return command
+}
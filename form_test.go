@@ -0,0 +1,180 @@
+package tgbot
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestBotFramework_Form(t *testing.T) {
+	t.Parallel()
+	sent := make(chan string, 100)
+	bot := getBotWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if path.Base(r.URL.Path) == "sendMessage" {
+			sent <- r.Form.Get("text")
+		}
+		okHandler(w, r)
+	})
+
+	var (
+		answers   FormAnswers
+		cancelled bool
+		helped    bool
+	)
+	err := bot.RegisterForm("signup", &Form{
+		Steps: []FormStep{
+			{Name: "name", Prompt: "name?", Validate: func(message *tgbotapi.Message) error {
+				if len(message.Text) < 2 {
+					return errors.New("too short")
+				}
+				return nil
+			}},
+			{Name: "phone", Prompt: "phone?", Kind: KindContact},
+			{Name: "place", Prompt: "place?", Kind: KindLocation},
+		},
+		OnComplete: func(bot *BotFramework, update *tgbotapi.Update, a FormAnswers) error {
+			answers = a
+			return nil
+		},
+		OnCancel: func(bot *BotFramework, update *tgbotapi.Update) error {
+			cancelled = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.RegisterCommand("/help", func(bot *BotFramework, update *tgbotapi.Update) error {
+		helped = true
+		return nil
+	}, 0)
+
+	send := func(message *tgbotapi.Message) {
+		t.Helper()
+		message.Chat = &tgbotapi.Chat{ID: 1}
+		message.From = &tgbotapi.User{ID: 42}
+		if strings.HasPrefix(message.Text, "/") {
+			message.Entities = []tgbotapi.MessageEntity{{Offset: 0, Length: len(message.Text), Type: "bot_command"}}
+		}
+		if err := bot.HandleUpdate(&tgbotapi.Update{Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectSent := func(expected string) {
+		t.Helper()
+		select {
+		case text := <-sent:
+			if text != expected {
+				t.Errorf("expected %q to be sent, got %q", expected, text)
+			}
+		default:
+			t.Errorf("expected %q to be sent, nothing was sent", expected)
+		}
+	}
+
+	if err = bot.StartForm("signup", 1, 42); err != nil {
+		t.Fatal(err)
+	}
+	expectSent("name?")
+	send(&tgbotapi.Message{Text: "A"})
+	expectSent("too short\nname?")
+	send(&tgbotapi.Message{Text: "Alice"})
+	expectSent("phone?")
+	send(&tgbotapi.Message{Text: "123"})
+	expectSent(DefaultFormInvalidInput + "\nphone?")
+	send(&tgbotapi.Message{Text: "/back"})
+	expectSent("name?")
+	send(&tgbotapi.Message{Text: "Bob"})
+	expectSent("phone?")
+	send(&tgbotapi.Message{Contact: &tgbotapi.Contact{PhoneNumber: "+100"}})
+	expectSent("place?")
+	send(&tgbotapi.Message{Text: "/help"})
+	if !helped {
+		t.Error("other commands must be dispatched as usual")
+	}
+	send(&tgbotapi.Message{Location: &tgbotapi.Location{Latitude: 1, Longitude: 2}})
+
+	if len(answers) != 3 || answers["name"].Text != "Bob" ||
+		answers["phone"].Contact.PhoneNumber != "+100" || answers["place"].Location.Latitude != 1 {
+		t.Errorf("unexpected answers %+v", answers)
+	}
+	if state := bot.GetState(1, 42); state != "" {
+		t.Errorf("state must be reset after completion, got %q", state)
+	}
+
+	if err = bot.StartForm("signup", 1, 42); err != nil {
+		t.Fatal(err)
+	}
+	expectSent("name?")
+	send(&tgbotapi.Message{Text: "/cancel"})
+	if !cancelled {
+		t.Error("OnCancel must be called")
+	}
+	if state := bot.GetState(1, 42); state != "" {
+		t.Errorf("state must be reset after cancel, got %q", state)
+	}
+	if len(sent) != 0 {
+		t.Errorf("unexpected message %q", <-sent)
+	}
+
+	if err = bot.StartForm("unknown", 1, 42); err == nil {
+		t.Error("starting unknown form must fail")
+	}
+}
+
+func TestBotFramework_FormConcurrentAnswers(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	var completed int64
+	err := bot.RegisterForm("quick", &Form{
+		Steps: []FormStep{
+			{Name: "name", Prompt: "name?", Validate: func(message *tgbotapi.Message) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			}},
+		},
+		OnComplete: func(bot *BotFramework, update *tgbotapi.Update, a FormAnswers) error {
+			atomic.AddInt64(&completed, 1)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bot.StartForm("quick", 123, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: 123},
+				From: &tgbotapi.User{ID: 42},
+				Text: "John",
+			}})
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				t.Errorf("concurrent answer panicked: %v", panicErr.Value)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&completed); n != 1 {
+		t.Errorf("form must be completed once, got %d", n)
+	}
+}
@@ -0,0 +1,122 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StateKey identifies conversation of user in chat.
+// UserID = 0 means state of the whole chat
+type StateKey struct {
+	ChatID int64
+	UserID int64
+}
+
+// GetUserID returns ID of user who sent the update, 0 if update has no sender
+func (bot *BotFramework) GetUserID(update *tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil && update.Message.From != nil:
+		return update.Message.From.ID
+	case update.EditedMessage != nil && update.EditedMessage.From != nil:
+		return update.EditedMessage.From.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.From != nil:
+		return update.CallbackQuery.From.ID
+	case update.InlineQuery != nil && update.InlineQuery.From != nil:
+		return update.InlineQuery.From.ID
+	case update.ChosenInlineResult != nil && update.ChosenInlineResult.From != nil:
+		return update.ChosenInlineResult.From.ID
+	case update.ShippingQuery != nil && update.ShippingQuery.From != nil:
+		return update.ShippingQuery.From.ID
+	case update.PreCheckoutQuery != nil && update.PreCheckoutQuery.From != nil:
+		return update.PreCheckoutQuery.From.ID
+	case update.PollAnswer != nil:
+		return update.PollAnswer.User.ID
+	case update.MyChatMember != nil:
+		return update.MyChatMember.From.ID
+	case update.ChatMember != nil:
+		return update.ChatMember.From.ID
+	case update.ChatJoinRequest != nil:
+		return update.ChatJoinRequest.From.ID
+	}
+	return 0
+}
+
+// SetState sets conversation state of user in chat.
+// If userID = 0, state is set for the whole chat. Empty state resets it
+func (bot *BotFramework) SetState(chatID, userID int64, state string) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	key := StateKey{ChatID: chatID, UserID: userID}
+	if state == "" {
+		delete(bot.states, key)
+		return
+	}
+	bot.states[key] = state
+}
+
+// GetState returns conversation state of user in chat, empty string if there is no state
+func (bot *BotFramework) GetState(chatID, userID int64) string {
+	bot.mu.RLock()
+	defer bot.mu.RUnlock()
+	return bot.states[StateKey{ChatID: chatID, UserID: userID}]
+}
+
+// ResetState deletes conversation state of user in chat
+func (bot *BotFramework) ResetState(chatID, userID int64) {
+	bot.SetState(chatID, userID, "")
+}
+
+// RegisterStateHandler binds handler for updates from users in given state.
+// State handlers are checked before any other handlers: state of user in chat first, then state of the whole chat.
+// If state handler returns NoHandlersError, update is dispatched as usual,
+// so commands like "/cancel" can be handled by regular command handlers
+// For example:
+//
+//	bot.RegisterStateHandler("ask_name", SomeNameHandler)
+//	bot.SetState(chatID, userID, "ask_name")
+func (bot *BotFramework) RegisterStateHandler(state string, f CommonHandler, mw ...Middleware) error {
+	if state == "" {
+		return errors.New("state must not be empty")
+	}
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.stateHandlers[state] = chain(f, mw)
+	return nil
+}
+
+// UnregisterStateHandler deletes handler for given state
+func (bot *BotFramework) UnregisterStateHandler(state string) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.stateHandlers, state)
+	return nil
+}
+
+// handleState calls handler of current state of update sender
+func (bot *BotFramework) handleState(update *tgbotapi.Update) error {
+	chatID, userID := bot.GetChatID(update), bot.GetUserID(update)
+
+	bot.mu.RLock()
+	var (
+		state   string
+		command CommonHandler
+		ok      bool
+	)
+	for _, key := range []StateKey{{ChatID: chatID, UserID: userID}, {ChatID: chatID}} {
+		if state, ok = bot.states[key]; ok {
+			command, ok = bot.stateHandlers[state]
+			break
+		}
+	}
+	bot.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: chatID=%d, userID=%d, state=%s", NoHandlersError, chatID, userID, state)
+	}
+	return bot.call(command, update)
+}
@@ -0,0 +1,174 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// InlineMatch defines how inline query text is matched against registered pattern
+type InlineMatch int
+
+const (
+	// InlineExact matches query equal to pattern
+	InlineExact InlineMatch = iota
+	// InlinePrefix matches query starting with pattern
+	InlinePrefix
+	// InlineRegexp matches query containing match of regular expression pattern
+	InlineRegexp
+	// InlineAny matches any query, pattern is ignored
+	InlineAny
+)
+
+// inlineRouter keeps inline query handlers of all match modes.
+// Handlers are tried in order: exact, the longest prefix, regexps in registration order, catch-all.
+// Within every mode handler for given user takes precedence over handler for user 0
+type inlineRouter struct {
+	exact   map[string]map[int64]CommonHandler
+	prefix  *prefixTree
+	regexps []*regexpRoute
+	any     map[int64]CommonHandler
+}
+
+func newInlineRouter() *inlineRouter {
+	return &inlineRouter{
+		exact:  make(map[string]map[int64]CommonHandler),
+		prefix: newPrefixTree(),
+		any:    make(map[int64]CommonHandler),
+	}
+}
+
+type inlineQueryRestKey struct{}
+
+// InlineQueryRest returns text of inline query left after the matched part.
+// For InlineExact it is empty, for InlineAny it is the whole query
+// For example:
+//
+//	rest := tgbot.InlineQueryRest(bot.Context(update))
+func InlineQueryRest(ctx context.Context) string {
+	rest, _ := ctx.Value(inlineQueryRestKey{}).(string)
+	return rest
+}
+
+// RegisterInlineQueryRoute binds handler for inline queries matched by pattern with given mode
+// If userID = 0, handler will work for any user
+// Precedence of modes is: InlineExact, InlinePrefix (the longest one), InlineRegexp (in registration order), InlineAny
+func (bot *BotFramework) RegisterInlineQueryRoute(f CommonHandler, match InlineMatch, pattern string, userID int64, mw ...Middleware) error {
+	var re *regexp.Regexp
+	if match == InlineRegexp {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	r := bot.inlineQueryHandlers
+	f = chain(f, mw)
+
+	switch match {
+	case InlineExact:
+		if _, ok := r.exact[pattern]; !ok {
+			r.exact[pattern] = make(map[int64]CommonHandler)
+		}
+		r.exact[pattern][userID] = f
+	case InlinePrefix:
+		r.prefix.set(pattern, userID, f)
+	case InlineRegexp:
+		for _, route := range r.regexps {
+			if route.re.String() == pattern {
+				route.handlers[userID] = f
+				return nil
+			}
+		}
+		r.regexps = append(r.regexps, &regexpRoute{
+			re:       re,
+			handlers: map[int64]CommonHandler{userID: f},
+		})
+	case InlineAny:
+		r.any[userID] = f
+	default:
+		return fmt.Errorf("unknown inline match mode %d", match)
+	}
+	return nil
+}
+
+// UnregisterInlineQueryRoute deletes handler for given user
+func (bot *BotFramework) UnregisterInlineQueryRoute(match InlineMatch, pattern string, userID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	r := bot.inlineQueryHandlers
+
+	switch match {
+	case InlineExact:
+		delete(r.exact[pattern], userID)
+	case InlinePrefix:
+		r.prefix.remove(pattern, userID)
+	case InlineRegexp:
+		for i, route := range r.regexps {
+			if route.re.String() != pattern {
+				continue
+			}
+			delete(route.handlers, userID)
+			if len(route.handlers) == 0 {
+				r.regexps = append(r.regexps[:i:i], r.regexps[i+1:]...)
+			}
+			break
+		}
+	case InlineAny:
+		delete(r.any, userID)
+	default:
+		return fmt.Errorf("unknown inline match mode %d", match)
+	}
+	return nil
+}
+
+// match finds handler for query and returns text left after the matched part
+func (r *inlineRouter) match(query string, userID int64) (CommonHandler, string, bool) {
+	if f, ok := byChat(r.exact[query], userID); ok {
+		return f, "", true
+	}
+	if f, n, ok := r.prefix.match(query, userID); ok {
+		return f, query[n:], true
+	}
+	for _, route := range r.regexps {
+		loc := route.re.FindStringIndex(query)
+		if loc == nil {
+			continue
+		}
+		if f, ok := byChat(route.handlers, userID); ok {
+			return f, query[loc[1]:], true
+		}
+	}
+	if f, ok := byChat(r.any, userID); ok {
+		return f, query, true
+	}
+	return nil, "", false
+}
+
+// byChat returns handler for given chat or for chat 0
+func byChat(handlers map[int64]CommonHandler, chatID int64) (CommonHandler, bool) {
+	if f, ok := handlers[chatID]; ok {
+		return f, true
+	}
+	f, ok := handlers[0]
+	return f, ok
+}
+
+func (bot *BotFramework) handleInlineQuery(update *tgbotapi.Update) error {
+	userID := int64(update.InlineQuery.From.ID)
+	query := update.InlineQuery.Query
+
+	bot.mu.RLock()
+	command, rest, ok := bot.inlineQueryHandlers.match(query, userID)
+	bot.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: inline, userID=%d, query=%s", NoHandlersError, userID, query)
+	}
+	bot.withValue(update, inlineQueryRestKey{}, rest)
+	return bot.call(command, update)
+}
@@ -0,0 +1,49 @@
+package tgbot
+
+import (
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RegisterChatJoinRequestHandler binds handler for requests to join given chat
+// If chatID = 0, handler will work in any chat
+// Use ApproveChatJoinRequest or DeclineChatJoinRequest to answer the request
+func (bot *BotFramework) RegisterChatJoinRequestHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers["chat_join_request"][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterChatJoinRequestHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterChatJoinRequestHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers["chat_join_request"], chatID)
+	return nil
+}
+
+// ApproveChatJoinRequest approves join request from update
+func (bot *BotFramework) ApproveChatJoinRequest(update *tgbotapi.Update) error {
+	if update.ChatJoinRequest == nil {
+		return errors.New("no chat join request")
+	}
+	_, err := bot.Request(tgbotapi.ApproveChatJoinRequestConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: update.ChatJoinRequest.Chat.ID},
+		UserID:     update.ChatJoinRequest.From.ID,
+	})
+	return err
+}
+
+// DeclineChatJoinRequest declines join request from update
+func (bot *BotFramework) DeclineChatJoinRequest(update *tgbotapi.Update) error {
+	if update.ChatJoinRequest == nil {
+		return errors.New("no chat join request")
+	}
+	_, err := bot.Request(tgbotapi.DeclineChatJoinRequest{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: update.ChatJoinRequest.Chat.ID},
+		UserID:     update.ChatJoinRequest.From.ID,
+	})
+	return err
+}
@@ -0,0 +1,141 @@
+package tgbot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Message kinds used to route messages and channel posts by content
+const (
+	KindAny       = "any"
+	KindText      = "plain"
+	KindPhoto     = "photo"
+	KindFile      = "file"
+	KindContact   = "contact"
+	KindSticker   = "sticker"
+	KindAudio     = "audio"
+	KindVideo     = "video"
+	KindVideoNote = "video_note"
+	KindVoice     = "voice"
+	KindLocation  = "location"
+	KindVenue     = "venue"
+	KindAnimation = "animation"
+	KindDice      = "dice"
+	KindGame      = "game"
+	KindPoll      = "poll"
+	KindInvoice   = "invoice"
+
+	KindSuccessfulPayment = "successful_payment"
+
+	KindNewChatMembers = "new_chat_members"
+	KindLeftChatMember = "left_chat_member"
+	KindPinnedMessage  = "pinned_message"
+	KindNewChatTitle   = "new_chat_title"
+	KindMigration      = "migration"
+)
+
+// messageKinds lists all kinds accepted by Register* methods with kind argument
+var messageKinds = map[string]bool{
+	KindAny:       true,
+	KindText:      true,
+	KindPhoto:     true,
+	KindFile:      true,
+	KindContact:   true,
+	KindSticker:   true,
+	KindAudio:     true,
+	KindVideo:     true,
+	KindVideoNote: true,
+	KindVoice:     true,
+	KindLocation:  true,
+	KindVenue:     true,
+	KindAnimation: true,
+	KindDice:      true,
+	KindGame:      true,
+	KindPoll:      true,
+	KindInvoice:   true,
+
+	KindSuccessfulPayment: true,
+
+	KindNewChatMembers: true,
+	KindLeftChatMember: true,
+	KindPinnedMessage:  true,
+	KindNewChatTitle:   true,
+	KindMigration:      true,
+}
+
+// quietKinds are kinds of messages which are not reported as unhandled,
+// users don't expect bot to respond to them: service messages, payments, dice, games, polls and invoices
+var quietKinds = map[string]bool{
+	KindDice:    true,
+	KindGame:    true,
+	KindPoll:    true,
+	KindInvoice: true,
+
+	KindSuccessfulPayment: true,
+
+	KindNewChatMembers: true,
+	KindLeftChatMember: true,
+	KindPinnedMessage:  true,
+	KindNewChatTitle:   true,
+	KindMigration:      true,
+}
+
+// kindFallbacks maps kind to more general kind which handler is used when kind has no handler.
+// Animations were routed as files and venues as locations before they got own kinds
+var kindFallbacks = map[string]string{
+	KindAnimation: KindFile,
+	KindVenue:     KindLocation,
+}
+
+// messageKind detects kind of message content.
+// Returns empty string for messages of unknown kind
+func messageKind(message *tgbotapi.Message) string {
+	switch {
+	case message.NewChatMembers != nil:
+		return KindNewChatMembers
+	case message.LeftChatMember != nil:
+		return KindLeftChatMember
+	case message.PinnedMessage != nil:
+		return KindPinnedMessage
+	case message.NewChatTitle != "":
+		return KindNewChatTitle
+	case message.MigrateToChatID != 0 || message.MigrateFromChatID != 0:
+		return KindMigration
+	case message.Photo != nil:
+		return KindPhoto
+	case message.Animation != nil:
+		// animation messages have Document set for backward compatibility
+		return KindAnimation
+	case message.Document != nil:
+		return KindFile
+	case message.Contact != nil:
+		return KindContact
+	case message.Sticker != nil:
+		return KindSticker
+	case message.Audio != nil:
+		return KindAudio
+	case message.Video != nil:
+		return KindVideo
+	case message.VideoNote != nil:
+		return KindVideoNote
+	case message.Voice != nil:
+		return KindVoice
+	case message.Venue != nil:
+		// venue messages have Location set too
+		return KindVenue
+	case message.Location != nil:
+		return KindLocation
+	case message.Dice != nil:
+		return KindDice
+	case message.Game != nil:
+		return KindGame
+	case message.Poll != nil:
+		return KindPoll
+	case message.Invoice != nil:
+		return KindInvoice
+	case message.SuccessfulPayment != nil:
+		return KindSuccessfulPayment
+	case message.Text != "":
+		return KindText
+	}
+	return ""
+}
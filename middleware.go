@@ -0,0 +1,36 @@
+package tgbot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Middleware wraps handler with cross-cutting logic like auth, logging or metrics
+type Middleware func(next CommonHandler) CommonHandler
+
+// Use appends middleware to the global stack.
+// Global middleware is applied around every handler called by HandleUpdate:
+// commands, callback and inline queries, media and universal handlers.
+// First added middleware is the outermost one.
+func (bot *BotFramework) Use(mw ...Middleware) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.middleware = append(bot.middleware, mw...)
+}
+
+// chain wraps f with given middleware, first one becomes the outermost
+func chain(f CommonHandler, mw []Middleware) CommonHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		if mw[i] != nil {
+			f = mw[i](f)
+		}
+	}
+	return f
+}
+
+// call runs handler wrapped with global middleware
+func (bot *BotFramework) call(f CommonHandler, update *tgbotapi.Update) error {
+	bot.mu.RLock()
+	mw := bot.middleware
+	bot.mu.RUnlock()
+	return chain(f, mw)(bot, update)
+}
@@ -0,0 +1,122 @@
+package tgbot
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MigrateChat moves commands, patterns, callback query and message handlers registered for oldChatID to newChatID,
+// as well as conversation states, forms progress and pending WaitForMessage calls. Handlers and states already set for newChatID are kept.
+// Sessions are moved if bot.Sessions implements SessionMigrator, error of the store is passed to ErrorHandler.
+// It is called automatically when group is upgraded to supergroup
+func (bot *BotFramework) MigrateChat(oldChatID, newChatID int64) {
+	if oldChatID == 0 || newChatID == 0 || oldChatID == newChatID {
+		return
+	}
+	bot.migrateRegistrations(oldChatID, newChatID)
+
+	if migrator, ok := bot.Sessions.(SessionMigrator); ok {
+		if err := migrator.MigrateSessions(oldChatID, newChatID); err != nil {
+			bot.ErrorHandler(tgbotapi.Update{}, fmt.Errorf("migrate sessions of chat %d to %d: %w", oldChatID, newChatID, err))
+		}
+	}
+}
+
+// migrateRegistrations moves handlers, states, forms progress, waiters and expiries of old chat to new one
+func (bot *BotFramework) migrateRegistrations(oldChatID, newChatID int64) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	bot.migrateWaiters(oldChatID, newChatID)
+	bot.migrateExpiries(oldChatID, newChatID)
+	for _, handlers := range bot.commands {
+		migrateHandlers(handlers, oldChatID, newChatID)
+	}
+	for _, handlers := range bot.handlers {
+		migrateHandlers(handlers, oldChatID, newChatID)
+	}
+	for _, route := range bot.patterns {
+		migrateHandlers(route.handlers, oldChatID, newChatID)
+	}
+	bot.callbackQueryHandlers.root.migrate(oldChatID, newChatID)
+
+	for key, state := range bot.states {
+		if key.ChatID != oldChatID {
+			continue
+		}
+		newKey := StateKey{ChatID: newChatID, UserID: key.UserID}
+		if _, exists := bot.states[newKey]; !exists {
+			bot.states[newKey] = state
+		}
+		delete(bot.states, key)
+	}
+	for key, progress := range bot.formProgress {
+		if key.ChatID != oldChatID {
+			continue
+		}
+		newKey := StateKey{ChatID: newChatID, UserID: key.UserID}
+		if bot.states[newKey] == formStatePrefix+progress.name {
+			if _, exists := bot.formProgress[newKey]; !exists {
+				bot.formProgress[newKey] = progress
+			}
+		}
+		delete(bot.formProgress, key)
+	}
+}
+
+// migrateHandlers moves handler of old chat to new one unless new chat has its own handler
+func migrateHandlers(handlers map[int64]CommonHandler, oldChatID, newChatID int64) {
+	f, ok := handlers[oldChatID]
+	if !ok {
+		return
+	}
+	if _, exists := handlers[newChatID]; !exists {
+		handlers[newChatID] = f
+	}
+	delete(handlers, oldChatID)
+}
+
+func (n *prefixNode) migrate(oldChatID, newChatID int64) {
+	migrateHandlers(n.handlers, oldChatID, newChatID)
+	for _, child := range n.children {
+		child.migrate(oldChatID, newChatID)
+	}
+}
+
+// migrateOnUpdate migrates registrations and calls OnChatMigrate if message tells that group is upgraded to supergroup.
+// It runs before any handler, so migration happens whichever handler consumes the message
+func (bot *BotFramework) migrateOnUpdate(update *tgbotapi.Update) {
+	message := update.Message
+	if message == nil || message.Chat == nil || (message.MigrateToChatID == 0 && message.MigrateFromChatID == 0) {
+		return
+	}
+
+	oldChatID, newChatID := migrationChats(message)
+	bot.MigrateChat(oldChatID, newChatID)
+	if bot.OnChatMigrate != nil {
+		bot.OnChatMigrate(oldChatID, newChatID)
+	}
+}
+
+// migrationChats returns old and new chat IDs of migration message
+func migrationChats(message *tgbotapi.Message) (oldChatID, newChatID int64) {
+	if message.MigrateFromChatID != 0 {
+		return message.MigrateFromChatID, message.Chat.ID
+	}
+	return message.Chat.ID, message.MigrateToChatID
+}
+
+// handleMigration calls migration handler of the new chat, registrations are already migrated by migrateOnUpdate
+func (bot *BotFramework) handleMigration(update *tgbotapi.Update) error {
+	_, newChatID := migrationChats(update.Message)
+
+	bot.mu.RLock()
+	command, ok := byChat(bot.handlers[KindMigration], newChatID)
+	bot.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: chatID=%d, event=%s", NoHandlersError, newChatID, KindMigration)
+	}
+	return bot.call(command, update)
+}
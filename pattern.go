@@ -0,0 +1,97 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// regexpRoute binds handlers to regular expression
+type regexpRoute struct {
+	re       *regexp.Regexp
+	handlers map[int64]CommonHandler
+}
+
+type patternParamsKey struct{}
+
+// PatternParams returns named capture groups of pattern matched by RegisterPattern handler
+// For example:
+//
+//	bot.RegisterPattern(regexp.MustCompile(`^order (?P<id>\d+)$`), OrderHandler, 0)
+//	...
+//	id := tgbot.PatternParams(bot.Context(update))["id"]
+func PatternParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(patternParamsKey{}).(map[string]string)
+	return params
+}
+
+// RegisterPattern binds handler for messages with text matching regular expression
+// If chatID = 0, pattern will work in any chat
+// Patterns are checked after exact commands in registration order,
+// plain text handler is called if no pattern matches
+func (bot *BotFramework) RegisterPattern(re *regexp.Regexp, f CommonHandler, chatID int64, mw ...Middleware) error {
+	if re == nil {
+		return errors.New("pattern must not be nil")
+	}
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	for _, route := range bot.patterns {
+		if route.re.String() == re.String() {
+			route.handlers[chatID] = chain(f, mw)
+			return nil
+		}
+	}
+	bot.patterns = append(bot.patterns, &regexpRoute{
+		re:       re,
+		handlers: map[int64]CommonHandler{chatID: chain(f, mw)},
+	})
+	return nil
+}
+
+// UnregisterPattern deletes pattern handler for given chat
+func (bot *BotFramework) UnregisterPattern(re *regexp.Regexp, chatID int64) error {
+	if re == nil {
+		return errors.New("pattern must not be nil")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	for i, route := range bot.patterns {
+		if route.re.String() != re.String() {
+			continue
+		}
+		delete(route.handlers, chatID)
+		if len(route.handlers) == 0 {
+			bot.patterns = append(bot.patterns[:i:i], bot.patterns[i+1:]...)
+		}
+		break
+	}
+	return nil
+}
+
+// matchPattern finds the first pattern matching text, which has handler for given chat.
+// Must be called with bot.mu held
+func (bot *BotFramework) matchPattern(text string, chatID int64) (CommonHandler, map[string]string, bool) {
+	for _, route := range bot.patterns {
+		f, ok := byChat(route.handlers, chatID)
+		if !ok {
+			continue
+		}
+		match := route.re.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		params := make(map[string]string)
+		for i, name := range route.re.SubexpNames() {
+			if name != "" {
+				params[name] = match[i]
+			}
+		}
+		return f, params, true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,214 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultPreCheckoutTimeout is used when BotFramework.PreCheckoutTimeout is not set.
+// Telegram waits for answer to pre-checkout query for 10 seconds
+const DefaultPreCheckoutTimeout = 8 * time.Second
+
+// PreCheckoutFailedMessage is shown to user when pre-checkout query handler fails or times out.
+// Handler errors may contain internal details, so they are never sent to user
+const PreCheckoutFailedMessage = "Payment service is temporarily unavailable, please try again"
+
+// PreCheckoutError is returned by pre-checkout query handler to decline payment with Message shown to user
+// For example:
+//
+//	return &tgbot.PreCheckoutError{Message: "Sorry, this item is out of stock"}
+type PreCheckoutError struct {
+	Message string
+}
+
+func (e *PreCheckoutError) Error() string {
+	return "pre-checkout query declined: " + e.Message
+}
+
+// RegisterShippingQueryHandler binds handler for shipping queries of invoices with payload starting with payloadPrefix
+// Handler must answer the query with bot.Request(tgbotapi.ShippingConfig{...})
+// The longest matching prefix is chosen like in RegisterCallbackQueryHandler
+func (bot *BotFramework) RegisterShippingQueryHandler(f CommonHandler, payloadPrefix string, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.shippingQueryHandlers.set(payloadPrefix, 0, chain(f, mw))
+	return nil
+}
+
+// UnregisterShippingQueryHandler deletes shipping query handler
+func (bot *BotFramework) UnregisterShippingQueryHandler(payloadPrefix string) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.shippingQueryHandlers.remove(payloadPrefix, 0)
+	return nil
+}
+
+// RegisterPreCheckoutQueryHandler binds handler for pre-checkout queries of invoices with payload starting with payloadPrefix
+// The query is always answered: if handler doesn't call AnswerPreCheckoutQuery,
+// it is approved when handler returns nil and declined when handler fails.
+// User sees Message of *PreCheckoutError returned by handler or PreCheckoutFailedMessage for other errors.
+// If there is no handler or it doesn't return in PreCheckoutTimeout, the query is declined.
+// Pre-checkout queries are dispatched before state and universal handlers, so they can't be swallowed.
+// The longest matching prefix is chosen like in RegisterCallbackQueryHandler
+func (bot *BotFramework) RegisterPreCheckoutQueryHandler(f CommonHandler, payloadPrefix string, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.preCheckoutQueryHandlers.set(payloadPrefix, 0, chain(f, mw))
+	return nil
+}
+
+// UnregisterPreCheckoutQueryHandler deletes pre-checkout query handler
+func (bot *BotFramework) UnregisterPreCheckoutQueryHandler(payloadPrefix string) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.preCheckoutQueryHandlers.remove(payloadPrefix, 0)
+	return nil
+}
+
+// RegisterSuccessfulPaymentHandler binds handler for successful payment messages of invoices with payload starting with payloadPrefix
+// The longest matching prefix is chosen like in RegisterCallbackQueryHandler
+func (bot *BotFramework) RegisterSuccessfulPaymentHandler(f CommonHandler, payloadPrefix string, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.successfulPaymentHandlers.set(payloadPrefix, 0, chain(f, mw))
+	return nil
+}
+
+// UnregisterSuccessfulPaymentHandler deletes successful payment handler
+func (bot *BotFramework) UnregisterSuccessfulPaymentHandler(payloadPrefix string) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.successfulPaymentHandlers.remove(payloadPrefix, 0)
+	return nil
+}
+
+// AnswerPreCheckoutQuery answers pre-checkout query from update.
+// errorMessage is shown to user when ok is false.
+// Query can be answered only once, including automatic answer of the framework
+func (bot *BotFramework) AnswerPreCheckoutQuery(update *tgbotapi.Update, ok bool, errorMessage string) error {
+	if update.PreCheckoutQuery == nil {
+		return errors.New("no pre-checkout query")
+	}
+	sent, err := bot.answerPreCheckoutQuery(update.PreCheckoutQuery.ID, ok, errorMessage)
+	if err == nil && !sent {
+		return fmt.Errorf("pre-checkout query %s is already answered", update.PreCheckoutQuery.ID)
+	}
+	return err
+}
+
+// answerPreCheckoutQuery sends answer if query is not answered yet
+func (bot *BotFramework) answerPreCheckoutQuery(queryID string, ok bool, errorMessage string) (bool, error) {
+	if _, answered := bot.preCheckoutAnswers.LoadOrStore(queryID, true); answered {
+		return false, nil
+	}
+	// PreCheckoutConfig omits ok=false, but the parameter is required
+	params := tgbotapi.Params{
+		"pre_checkout_query_id": queryID,
+		"ok":                    strconv.FormatBool(ok),
+	}
+	params.AddNonEmpty("error_message", errorMessage)
+	_, err := bot.MakeRequest("answerPreCheckoutQuery", params)
+	return true, err
+}
+
+func (bot *BotFramework) handleShippingQuery(update *tgbotapi.Update) error {
+	payload := update.ShippingQuery.InvoicePayload
+
+	bot.mu.RLock()
+	command, _, ok := bot.shippingQueryHandlers.match(payload, 0)
+	bot.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: shipping query, payload=%s", NoHandlersError, payload)
+	}
+	return bot.call(command, update)
+}
+
+func (bot *BotFramework) handleSuccessfulPayment(update *tgbotapi.Update) error {
+	payload := update.Message.SuccessfulPayment.InvoicePayload
+
+	bot.mu.RLock()
+	command, _, ok := bot.successfulPaymentHandlers.match(payload, 0)
+	bot.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: successful payment, payload=%s", NoHandlersError, payload)
+	}
+	return bot.call(command, update)
+}
+
+// handlePreCheckoutQuery runs handler with timeout and guarantees the query is answered
+func (bot *BotFramework) handlePreCheckoutQuery(update *tgbotapi.Update) error {
+	query := update.PreCheckoutQuery
+
+	bot.mu.RLock()
+	command, _, ok := bot.preCheckoutQueryHandlers.match(query.InvoicePayload, 0)
+	bot.mu.RUnlock()
+
+	if !ok {
+		err := fmt.Errorf("%w: pre-checkout query, payload=%s", NoHandlersError, query.InvoicePayload)
+		_, answerErr := bot.answerPreCheckoutQuery(query.ID, false, "Payment is not available")
+		bot.preCheckoutAnswers.Delete(query.ID)
+		if answerErr != nil {
+			return fmt.Errorf("%w, answer failed: %v", err, answerErr)
+		}
+		return err
+	}
+
+	timeout := bot.PreCheckoutTimeout
+	if timeout <= 0 {
+		timeout = DefaultPreCheckoutTimeout
+	}
+	ctx, cancel := context.WithTimeout(bot.Context(update), timeout)
+	defer cancel()
+
+	// handler may outlive HandleUpdateContext after timeout,
+	// so it gets a copy of update with context kept until handler returns
+	handled := *update
+	bot.contexts.Store(&handled, ctx)
+
+	done := make(chan error, 1)
+	go func() {
+		defer bot.contexts.Delete(&handled)
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &PanicError{Value: r, Stack: debug.Stack(), Update: *update}
+			}
+		}()
+		done <- bot.call(command, &handled)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+		defer bot.preCheckoutAnswers.Delete(query.ID)
+	case <-ctx.Done():
+		// handler may still try to answer, keep the mark until it returns
+		err = fmt.Errorf("pre-checkout query %s: %w", query.ID, ctx.Err())
+		go func() {
+			<-done
+			bot.preCheckoutAnswers.Delete(query.ID)
+		}()
+	}
+
+	if err == nil {
+		_, err = bot.answerPreCheckoutQuery(query.ID, true, "")
+		return err
+	}
+
+	message := PreCheckoutFailedMessage
+	var declined *PreCheckoutError
+	if errors.As(err, &declined) {
+		message = declined.Message
+	}
+	if _, answerErr := bot.answerPreCheckoutQuery(query.ID, false, message); answerErr != nil {
+		return fmt.Errorf("%w, answer failed: %v", err, answerErr)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestBotFramework_PreCheckoutQuery(t *testing.T) {
+	t.Parallel()
+
+	answers := make(chan string, 10)
+	bot := getBotWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if path.Base(r.URL.Path) == "answerPreCheckoutQuery" {
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			answers <- r.Form.Get("pre_checkout_query_id") + " " + r.Form.Get("ok") + " " + r.Form.Get("error_message")
+		}
+		okHandler(w, r)
+	})
+	bot.PreCheckoutTimeout = 50 * time.Millisecond
+
+	bot.RegisterPreCheckoutQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	}, "sub_")
+	bot.RegisterPreCheckoutQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return &PreCheckoutError{Message: "out of stock"}
+	}, "sub_gold_")
+	bot.RegisterPreCheckoutQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("db: connection refused")
+	}, "sub_bronze_")
+	bot.RegisterPreCheckoutQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return bot.AnswerPreCheckoutQuery(update, false, "custom")
+	}, "sub_silver_")
+	release := make(chan struct{})
+	lateCtxErr := make(chan error, 1)
+	lateAnswer := make(chan error)
+	bot.RegisterPreCheckoutQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		<-release
+		lateCtxErr <- bot.Context(update).Err()
+		lateAnswer <- bot.AnswerPreCheckoutQuery(update, true, "")
+		return nil
+	}, "sub_slow_")
+
+	cases := []struct {
+		id, payload string
+		expected    string
+		err         bool
+		is          error
+	}{
+		{"1", "sub_basic", "1 true ", false, nil},
+		{"2", "sub_gold_1m", "2 false out of stock", true, nil},
+		{"3", "sub_silver_1m", "3 false custom", false, nil},
+		{"4", "sub_bronze_1m", "4 false " + PreCheckoutFailedMessage, true, nil},
+		{"5", "sub_slow_1m", "5 false " + PreCheckoutFailedMessage, true, context.DeadlineExceeded},
+		{"6", "donation", "6 false Payment is not available", true, NoHandlersError},
+	}
+	for _, tc := range cases {
+		err := bot.HandleUpdate(&tgbotapi.Update{PreCheckoutQuery: &tgbotapi.PreCheckoutQuery{
+			ID:             tc.id,
+			From:           &tgbotapi.User{ID: 42},
+			InvoicePayload: tc.payload,
+		}})
+		if (err != nil) != tc.err {
+			t.Errorf("query %s: unexpected error %v", tc.id, err)
+		}
+		if tc.is != nil && !errors.Is(err, tc.is) {
+			t.Errorf("query %s: expected %v, got %v", tc.id, tc.is, err)
+		}
+		select {
+		case answer := <-answers:
+			if answer != tc.expected {
+				t.Errorf("query %s: expected answer %q, got %q", tc.id, tc.expected, answer)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("query %s is not answered", tc.id)
+		}
+	}
+
+	close(release)
+	if err := <-lateCtxErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler must see its expired context after timeout, got %v", err)
+	}
+	if err := <-lateAnswer; err == nil {
+		t.Error("query must be answered only once")
+	}
+	select {
+	case answer := <-answers:
+		t.Errorf("unexpected answer %q", answer)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBotFramework_PreCheckoutQueryBeforeUniversalHandler(t *testing.T) {
+	t.Parallel()
+
+	answers := make(chan string, 10)
+	bot := getBotWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if path.Base(r.URL.Path) == "answerPreCheckoutQuery" {
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			answers <- r.Form.Get("ok")
+		}
+		okHandler(w, r)
+	})
+
+	bot.RegisterUniversalHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	}, 0)
+	bot.RegisterStateHandler("busy", func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	})
+	bot.SetState(0, 42, "busy")
+	bot.RegisterPreCheckoutQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return nil
+	}, "")
+
+	err := bot.HandleUpdate(&tgbotapi.Update{PreCheckoutQuery: &tgbotapi.PreCheckoutQuery{
+		ID:   "1",
+		From: &tgbotapi.User{ID: 42},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ok := <-answers:
+		if ok != "true" {
+			t.Errorf("expected approval, got ok=%s", ok)
+		}
+	default:
+		t.Error("pre-checkout query must be answered despite universal and state handlers")
+	}
+}
+
+func TestBotFramework_SuccessfulPayment(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	bot.RegisterSuccessfulPaymentHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New(update.Message.SuccessfulPayment.InvoicePayload)
+	}, "sub_")
+	bot.RegisterShippingQueryHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		return errors.New("shipping")
+	}, "")
+
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:              &tgbotapi.Chat{ID: 123},
+		SuccessfulPayment: &tgbotapi.SuccessfulPayment{InvoicePayload: "sub_gold"},
+	}})
+	if err == nil || err.Error() != "sub_gold" {
+		t.Errorf("expected successful payment handler, got %v", err)
+	}
+	err = bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:              &tgbotapi.Chat{ID: 123},
+		SuccessfulPayment: &tgbotapi.SuccessfulPayment{InvoicePayload: "donation"},
+	}})
+	if err != nil {
+		t.Errorf("unhandled successful payment must not be reported, got %v", err)
+	}
+
+	err = bot.HandleUpdate(&tgbotapi.Update{ShippingQuery: &tgbotapi.ShippingQuery{
+		ID:             "1",
+		InvoicePayload: "anything",
+	}})
+	if err == nil || err.Error() != "shipping" {
+		t.Errorf("expected shipping query handler, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RegisterPollHandler binds handler for state updates of poll with given ID
+// If pollID is empty, handler will work for any poll
+// Bot receives state updates only for polls sent by itself and stopped polls.
+// Handlers bound to poll ID are removed after update of the closed poll is handled
+func (bot *BotFramework) RegisterPollHandler(f CommonHandler, pollID string, mw ...Middleware) error {
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.pollHandlers[pollID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterPollHandler deletes poll handler
+func (bot *BotFramework) UnregisterPollHandler(pollID string) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.pollHandlers, pollID)
+	return nil
+}
+
+// RegisterPollAnswerHandler binds handler for answers to poll with given ID
+// If pollID is empty, handler will work for any poll
+// Bot receives answers only for non-anonymous polls sent by itself
+func (bot *BotFramework) RegisterPollAnswerHandler(f CommonHandler, pollID string, mw ...Middleware) error {
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.pollAnswerHandlers[pollID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterPollAnswerHandler deletes poll answer handler
+func (bot *BotFramework) UnregisterPollAnswerHandler(pollID string) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.pollAnswerHandlers, pollID)
+	return nil
+}
+
+// SendPoll sends poll and binds answer handler f for it
+// IsAnonymous of config should be false, otherwise answers are not sent to bot.
+// Handler is removed when poll is closed, set OpenPeriod or CloseDate of config
+// or stop the poll with tgbotapi.StopPollConfig, so it doesn't stay registered forever
+// For example:
+//
+//	poll := tgbotapi.NewPoll(chatID, "2 + 2 = ?", "3", "4")
+//	poll.IsAnonymous = false
+//	_, err := bot.SendPoll(poll, SomeAnswerHandler)
+func (bot *BotFramework) SendPoll(config tgbotapi.SendPollConfig, f CommonHandler, mw ...Middleware) (tgbotapi.Message, error) {
+	if f == nil {
+		return tgbotapi.Message{}, errors.New("handler must not be nil")
+	}
+	message, err := bot.Send(config)
+	if err != nil {
+		return message, err
+	}
+	if message.Poll == nil {
+		return message, errors.New("sent message has no poll")
+	}
+	return message, bot.RegisterPollAnswerHandler(f, message.Poll.ID, mw...)
+}
+
+func (bot *BotFramework) handlePoll(update *tgbotapi.Update) error {
+	if update.Poll.IsClosed {
+		// closed poll gets neither answers nor state updates
+		defer bot.forgetPoll(update.Poll.ID)
+	}
+	return bot.handleByPollID(update, bot.pollHandlers, update.Poll.ID, "poll")
+}
+
+// forgetPoll deletes handlers bound to poll ID
+func (bot *BotFramework) forgetPoll(pollID string) {
+	if pollID == "" {
+		return
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.pollHandlers, pollID)
+	delete(bot.pollAnswerHandlers, pollID)
+}
+
+func (bot *BotFramework) handlePollAnswer(update *tgbotapi.Update) error {
+	return bot.handleByPollID(update, bot.pollAnswerHandlers, update.PollAnswer.PollID, "poll answer")
+}
+
+// handleByPollID calls handler of poll, falls back to handler for any poll
+func (bot *BotFramework) handleByPollID(update *tgbotapi.Update, handlers map[string]CommonHandler, pollID string, event string) error {
+	bot.mu.RLock()
+	command, ok := handlers[pollID]
+	if !ok {
+		command, ok = handlers[""]
+	}
+	bot.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s, pollID=%s", NoHandlersError, event, pollID)
+	}
+	return bot.call(command, update)
+}
@@ -1,6 +1,9 @@
 package tgbot
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // RegisterCommand binds handler for commands
 // If chatID=0, command will work in any chat
@@ -10,7 +13,9 @@ import "errors"
 // binds same handler for "/start", "/start@your_bot", "/start@your_bot someReferralCode"
 // 	bot.RegisterCommand("🔔 Subscribe", SomeSubscribeHandler, 0)
 // binds handler for message text "🔔 Subscribe"
-func (bot *BotFramework) RegisterCommand(name string, f CommonHandler, chatID int64) error {
+// Optional mw wraps only this handler and runs inside global middleware set by Use.
+// The same applies to mw of every other Register* method.
+func (bot *BotFramework) RegisterCommand(name string, f CommonHandler, chatID int64, mw ...Middleware) error {
 	if f == nil {
 		return errors.New("handler must not be nil")
 	}
@@ -20,7 +25,8 @@ func (bot *BotFramework) RegisterCommand(name string, f CommonHandler, chatID in
 	if _, ok := bot.commands[name]; !ok {
 		bot.commands[name] = make(map[int64]CommonHandler, 1)
 	}
-	bot.commands[name][chatID] = f
+	bot.commands[name][chatID] = chain(f, mw)
+	delete(bot.expiries, expiryKey{kind: expiryCommand, key: name, chatID: chatID})
 	return nil
 }
 
@@ -29,18 +35,21 @@ func (bot *BotFramework) UnregisterCommand(name string, chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
 	delete(bot.commands[name], chatID)
+	delete(bot.expiries, expiryKey{kind: expiryCommand, key: name, chatID: chatID})
 	return nil
 }
 
 // RegisterCallbackQueryHandler binds handler for callback data
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterCallbackQueryHandler(f CommonHandler, dataStartsWith string, chatID int64) error {
+// Callback data is routed to the handler with the longest matching dataStartsWith.
+// For the same dataStartsWith handler for given chat takes precedence over handler for chat 0,
+// if neither is registered, shorter prefixes are tried. For example, with "menu_" and "menu_settings_"
+// registered, "menu_settings_lang" always goes to "menu_settings_" handler
+func (bot *BotFramework) RegisterCallbackQueryHandler(f CommonHandler, dataStartsWith string, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	if _, ok := bot.callbackQueryHandlers[dataStartsWith]; !ok {
-		bot.callbackQueryHandlers[dataStartsWith] = make(map[int64]CommonHandler)
-	}
-	bot.callbackQueryHandlers[dataStartsWith][chatID] = f
+	bot.callbackQueryHandlers.set(dataStartsWith, chatID, chain(f, mw))
+	delete(bot.expiries, expiryKey{kind: expiryCallbackQuery, key: dataStartsWith, chatID: chatID})
 	return nil
 }
 
@@ -48,36 +57,49 @@ func (bot *BotFramework) RegisterCallbackQueryHandler(f CommonHandler, dataStart
 func (bot *BotFramework) UnregisterCallbackQueryHandler(dataStartsWith string, chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.callbackQueryHandlers[dataStartsWith], chatID)
+	bot.callbackQueryHandlers.remove(dataStartsWith, chatID)
+	delete(bot.expiries, expiryKey{kind: expiryCallbackQuery, key: dataStartsWith, chatID: chatID})
 	return nil
 }
 
-// RegisterInlineQueryHandler binds handler for query
-// If userID = 0, command will work for any user
-func (bot *BotFramework) RegisterInlineQueryHandler(f CommonHandler, query string, userID int64) error {
+// RegisterChosenInlineResultHandler binds handler for chosen inline results with ID starting with resultIDStartsWith
+// If userID = 0, handler will work for any user
+// Precedence is the same as in RegisterCallbackQueryHandler.
+// Inline feedback must be enabled with @BotFather to receive chosen results
+func (bot *BotFramework) RegisterChosenInlineResultHandler(f CommonHandler, resultIDStartsWith string, userID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	if _, ok := bot.inlineQueryHandlers[query]; !ok {
-		bot.inlineQueryHandlers[query] = make(map[int64]CommonHandler)
-	}
-	bot.inlineQueryHandlers[query][userID] = f
+	bot.chosenInlineResultHandlers.set(resultIDStartsWith, userID, chain(f, mw))
 	return nil
 }
 
-// UnregisterInlineQueryHandler deletes handler for given user
-func (bot *BotFramework) UnregisterInlineQueryHandler(query string, userID int64) error {
+// UnregisterChosenInlineResultHandler deletes handler for given user
+func (bot *BotFramework) UnregisterChosenInlineResultHandler(resultIDStartsWith string, userID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.inlineQueryHandlers[query], userID)
+	bot.chosenInlineResultHandlers.remove(resultIDStartsWith, userID)
 	return nil
 }
 
+// RegisterInlineQueryHandler binds handler for inline queries starting with query
+// If userID = 0, command will work for any user
+// Use RegisterInlineQueryRoute for other match modes
+func (bot *BotFramework) RegisterInlineQueryHandler(f CommonHandler, query string, userID int64, mw ...Middleware) error {
+	return bot.RegisterInlineQueryRoute(f, InlinePrefix, query, userID, mw...)
+}
+
+// UnregisterInlineQueryHandler deletes handler for given user
+func (bot *BotFramework) UnregisterInlineQueryHandler(query string, userID int64) error {
+	return bot.UnregisterInlineQueryRoute(InlinePrefix, query, userID)
+}
+
 // RegisterPlainTextHandler binds handler for plain text message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterPlainTextHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterPlainTextHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["plain"][chatID] = f
+	bot.handlers[KindText][chatID] = chain(f, mw)
+	delete(bot.expiries, expiryKey{kind: expiryPlainText, chatID: chatID})
 	return nil
 }
 
@@ -85,16 +107,17 @@ func (bot *BotFramework) RegisterPlainTextHandler(f CommonHandler, chatID int64)
 func (bot *BotFramework) UnregisterPlainTextHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["plain"], chatID)
+	delete(bot.handlers[KindText], chatID)
+	delete(bot.expiries, expiryKey{kind: expiryPlainText, chatID: chatID})
 	return nil
 }
 
 // RegisterContactHandler binds handler for contact message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterContactHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterContactHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["contact"][chatID] = f
+	bot.handlers[KindContact][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -102,16 +125,16 @@ func (bot *BotFramework) RegisterContactHandler(f CommonHandler, chatID int64) e
 func (bot *BotFramework) UnregisterContactHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["contact"], chatID)
+	delete(bot.handlers[KindContact], chatID)
 	return nil
 }
 
 // RegisterPhotoHandler binds handler for photo message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterPhotoHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterPhotoHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["photo"][chatID] = f
+	bot.handlers[KindPhoto][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -119,16 +142,16 @@ func (bot *BotFramework) RegisterPhotoHandler(f CommonHandler, chatID int64) err
 func (bot *BotFramework) UnregisterPhotoHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["photo"], chatID)
+	delete(bot.handlers[KindPhoto], chatID)
 	return nil
 }
 
 // RegisterFileHandler binds handler for file from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterFileHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterFileHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["file"][chatID] = f
+	bot.handlers[KindFile][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -136,16 +159,16 @@ func (bot *BotFramework) RegisterFileHandler(f CommonHandler, chatID int64) erro
 func (bot *BotFramework) UnregisterFileHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["file"], chatID)
+	delete(bot.handlers[KindFile], chatID)
 	return nil
 }
 
 // RegisterStickerHandler binds handler for sticker from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterStickerHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterStickerHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["sticker"][chatID] = f
+	bot.handlers[KindSticker][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -153,16 +176,16 @@ func (bot *BotFramework) RegisterStickerHandler(f CommonHandler, chatID int64) e
 func (bot *BotFramework) UnregisterStickerHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["sticker"], chatID)
+	delete(bot.handlers[KindSticker], chatID)
 	return nil
 }
 
 // RegisterAudioHandler binds handler for audio message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterAudioHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterAudioHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["audio"][chatID] = f
+	bot.handlers[KindAudio][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -170,16 +193,16 @@ func (bot *BotFramework) RegisterAudioHandler(f CommonHandler, chatID int64) err
 func (bot *BotFramework) UnregisterAudioHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["audio"], chatID)
+	delete(bot.handlers[KindAudio], chatID)
 	return nil
 }
 
 // RegisterVideoHandler binds handler for video message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterVideoHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterVideoHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["video"][chatID] = f
+	bot.handlers[KindVideo][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -187,16 +210,16 @@ func (bot *BotFramework) RegisterVideoHandler(f CommonHandler, chatID int64) err
 func (bot *BotFramework) UnregisterVideoHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["video"], chatID)
+	delete(bot.handlers[KindVideo], chatID)
 	return nil
 }
 
 // RegisterVideoNoteHandler binds handler for video_note message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterVideoNoteHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterVideoNoteHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["video_note"][chatID] = f
+	bot.handlers[KindVideoNote][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -204,16 +227,16 @@ func (bot *BotFramework) RegisterVideoNoteHandler(f CommonHandler, chatID int64)
 func (bot *BotFramework) UnregisterVideoNoteHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["video_note"], chatID)
+	delete(bot.handlers[KindVideoNote], chatID)
 	return nil
 }
 
 // RegisterVoiceHandler binds handler for voice message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterVoiceHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterVoiceHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["voice"][chatID] = f
+	bot.handlers[KindVoice][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -221,16 +244,17 @@ func (bot *BotFramework) RegisterVoiceHandler(f CommonHandler, chatID int64) err
 func (bot *BotFramework) UnregisterVoiceHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["voice"], chatID)
+	delete(bot.handlers[KindVoice], chatID)
 	return nil
 }
 
 // RegisterVenueHandler binds handler for venue message from given chat
-// If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterVenueHandler(f CommonHandler, chatID int64) error {
+// If chatID = 0, command will work in any chat.
+// Without venue handler venues are passed to location handler
+func (bot *BotFramework) RegisterVenueHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["venue"][chatID] = f
+	bot.handlers[KindVenue][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -238,16 +262,16 @@ func (bot *BotFramework) RegisterVenueHandler(f CommonHandler, chatID int64) err
 func (bot *BotFramework) UnregisterVenueHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["venue"], chatID)
+	delete(bot.handlers[KindVenue], chatID)
 	return nil
 }
 
 // RegisterLocationHandler binds handler for location message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterLocationHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterLocationHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["location"][chatID] = f
+	bot.handlers[KindLocation][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -255,16 +279,189 @@ func (bot *BotFramework) RegisterLocationHandler(f CommonHandler, chatID int64)
 func (bot *BotFramework) UnregisterLocationHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["location"], chatID)
+	delete(bot.handlers[KindLocation], chatID)
+	return nil
+}
+
+// RegisterAnimationHandler binds handler for animation (GIF) message from given chat
+// If chatID = 0, command will work in any chat.
+// Without animation handler animations are passed to file handler
+func (bot *BotFramework) RegisterAnimationHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindAnimation][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterAnimationHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterAnimationHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindAnimation], chatID)
+	return nil
+}
+
+// RegisterDiceHandler binds handler for dice message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterDiceHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindDice][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterDiceHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterDiceHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindDice], chatID)
+	return nil
+}
+
+// RegisterGameHandler binds handler for game message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterGameHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindGame][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterGameHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterGameHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindGame], chatID)
+	return nil
+}
+
+// RegisterPollMessageHandler binds handler for message with poll from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterPollMessageHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindPoll][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterPollMessageHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterPollMessageHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindPoll], chatID)
+	return nil
+}
+
+// RegisterInvoiceHandler binds handler for invoice message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterInvoiceHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindInvoice][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterInvoiceHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterInvoiceHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindInvoice], chatID)
+	return nil
+}
+
+// RegisterNewChatMembersHandler binds handler for new_chat_members service message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterNewChatMembersHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindNewChatMembers][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterNewChatMembersHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterNewChatMembersHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindNewChatMembers], chatID)
+	return nil
+}
+
+// RegisterLeftChatMemberHandler binds handler for left_chat_member service message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterLeftChatMemberHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindLeftChatMember][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterLeftChatMemberHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterLeftChatMemberHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindLeftChatMember], chatID)
+	return nil
+}
+
+// RegisterPinnedMessageHandler binds handler for pinned_message service message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterPinnedMessageHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindPinnedMessage][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterPinnedMessageHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterPinnedMessageHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindPinnedMessage], chatID)
+	return nil
+}
+
+// RegisterNewChatTitleHandler binds handler for new_chat_title service message from given chat
+// If chatID = 0, command will work in any chat
+func (bot *BotFramework) RegisterNewChatTitleHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindNewChatTitle][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterNewChatTitleHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterNewChatTitleHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindNewChatTitle], chatID)
+	return nil
+}
+
+// RegisterMigrationHandler binds handler for migrate_to_chat_id or migrate_from_chat_id service message from given chat
+// If chatID = 0, command will work in any chat
+// Handler is called after registrations are moved to the new chat ID (see MigrateChat),
+// so handler registered for the old chat is found under the new one
+func (bot *BotFramework) RegisterMigrationHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers[KindMigration][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterMigrationHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterMigrationHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[KindMigration], chatID)
 	return nil
 }
 
 // RegisterUniversalHandler binds handler for any message from given chat
 // If chatID = 0, command will work in any chat
-func (bot *BotFramework) RegisterUniversalHandler(f CommonHandler, chatID int64) error {
+func (bot *BotFramework) RegisterUniversalHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	bot.handlers["any"][chatID] = f
+	bot.handlers[KindAny][chatID] = chain(f, mw)
 	return nil
 }
 
@@ -272,6 +469,73 @@ func (bot *BotFramework) RegisterUniversalHandler(f CommonHandler, chatID int64)
 func (bot *BotFramework) UnregisterUniversalHandler(chatID int64) error {
 	bot.mu.Lock()
 	defer bot.mu.Unlock()
-	delete(bot.handlers["any"], chatID)
+	delete(bot.handlers[KindAny], chatID)
+	return nil
+}
+
+// RegisterEditedMessageHandler binds handler for edited messages from given chat
+// If chatID = 0, command will work in any chat
+// Handler receives update with EditedMessage set, IsEdited reports true for it
+func (bot *BotFramework) RegisterEditedMessageHandler(f CommonHandler, chatID int64, mw ...Middleware) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.handlers["edited"][chatID] = chain(f, mw)
+	return nil
+}
+
+// UnregisterEditedMessageHandler deletes handler for given chat
+func (bot *BotFramework) UnregisterEditedMessageHandler(chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers["edited"], chatID)
+	return nil
+}
+
+// RegisterChannelPostHandler binds handler for posts of given kind in channel
+// If chatID = 0, handler will work in any channel
+// kind is one of Kind* constants. KindAny handler is called if there is no handler for kind of the post
+func (bot *BotFramework) RegisterChannelPostHandler(f CommonHandler, kind string, chatID int64, mw ...Middleware) error {
+	return bot.registerKindHandler("channel_post", f, kind, chatID, mw)
+}
+
+// UnregisterChannelPostHandler deletes handler for given channel
+func (bot *BotFramework) UnregisterChannelPostHandler(kind string, chatID int64) error {
+	return bot.unregisterKindHandler("channel_post", kind, chatID)
+}
+
+// RegisterEditedChannelPostHandler binds handler for edited posts of given kind in channel
+// If chatID = 0, handler will work in any channel
+// kind is one of Kind* constants. KindAny handler is called if there is no handler for kind of the post
+func (bot *BotFramework) RegisterEditedChannelPostHandler(f CommonHandler, kind string, chatID int64, mw ...Middleware) error {
+	return bot.registerKindHandler("edited_channel_post", f, kind, chatID, mw)
+}
+
+// UnregisterEditedChannelPostHandler deletes handler for given channel
+func (bot *BotFramework) UnregisterEditedChannelPostHandler(kind string, chatID int64) error {
+	return bot.unregisterKindHandler("edited_channel_post", kind, chatID)
+}
+
+func (bot *BotFramework) registerKindHandler(event string, f CommonHandler, kind string, chatID int64, mw []Middleware) error {
+	if f == nil {
+		return errors.New("handler must not be nil")
+	}
+	if !messageKinds[kind] {
+		return fmt.Errorf("unknown message kind %q", kind)
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	key := event + "/" + kind
+	if _, ok := bot.handlers[key]; !ok {
+		bot.handlers[key] = make(map[int64]CommonHandler)
+	}
+	bot.handlers[key][chatID] = chain(f, mw)
+	return nil
+}
+
+func (bot *BotFramework) unregisterKindHandler(event string, kind string, chatID int64) error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	delete(bot.handlers[event+"/"+kind], chatID)
 	return nil
 }
@@ -0,0 +1,295 @@
+package tgbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SessionNotFoundError is returned when there is no session or it is expired
+var SessionNotFoundError = errors.New("session not found")
+
+// SessionKey identifies session of user in chat
+type SessionKey struct {
+	ChatID int64
+	UserID int64
+}
+
+// SessionStore keeps session data between updates.
+// Store should also implement SessionMigrator, otherwise sessions are lost when group is upgraded to supergroup
+type SessionStore interface {
+	// Get returns session data or SessionNotFoundError
+	Get(key SessionKey) ([]byte, error)
+	// Set saves session data. If ttl = 0, session never expires
+	Set(key SessionKey, data []byte, ttl time.Duration) error
+	// Delete removes session, deleting missing session is not an error
+	Delete(key SessionKey) error
+}
+
+// SessionMigrator is implemented by session stores which can move sessions of chat to another chat.
+// MigrateChat moves sessions only if bot.Sessions implements it, both built-in stores do
+type SessionMigrator interface {
+	// MigrateSessions moves sessions of oldChatID to newChatID. Sessions already stored for newChatID are kept
+	MigrateSessions(oldChatID, newChatID int64) error
+}
+
+// Session is a handle to session of update sender, see BotFramework.Session
+type Session struct {
+	store SessionStore
+	key   SessionKey
+}
+
+// Session returns session of user who sent the update in chat of the update.
+// Data is kept in bot.Sessions store
+// For example:
+//
+//	var cart Cart
+//	err := bot.Session(update).Load(&cart)
+//	...
+//	err = bot.Session(update).Save(cart, 24*time.Hour)
+func (bot *BotFramework) Session(update *tgbotapi.Update) *Session {
+	return &Session{
+		store: bot.Sessions,
+		key:   SessionKey{ChatID: bot.GetChatID(update), UserID: bot.GetUserID(update)},
+	}
+}
+
+// Key returns key of the session
+func (s *Session) Key() SessionKey {
+	return s.key
+}
+
+// Load decodes session data into v. Returns SessionNotFoundError if there is no session
+func (s *Session) Load(v interface{}) error {
+	data, err := s.store.Get(s.key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Save encodes v as JSON and stores it for ttl. If ttl = 0, session never expires
+func (s *Session) Save(v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(s.key, data, ttl)
+}
+
+// Delete removes the session
+func (s *Session) Delete() error {
+	return s.store.Delete(s.key)
+}
+
+// memorySessionSweepInterval is how often MemorySessionStore removes expired sessions
+const memorySessionSweepInterval = time.Minute
+
+// MemorySessionStore keeps sessions in memory. Sessions are lost on restart
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[SessionKey]sessionEntry
+	lastSweep time.Time
+}
+
+type sessionEntry struct {
+	Data    []byte    `json:"data"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (e sessionEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+func newSessionEntry(data []byte, ttl time.Duration) sessionEntry {
+	entry := sessionEntry{Data: append([]byte(nil), data...)}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+	return entry
+}
+
+// NewMemorySessionStore creates empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:  make(map[SessionKey]sessionEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Get returns session data or SessionNotFoundError
+func (s *MemorySessionStore) Get(key SessionKey) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[key]
+	if !ok {
+		return nil, SessionNotFoundError
+	}
+	if entry.expired(time.Now()) {
+		delete(s.sessions, key)
+		return nil, SessionNotFoundError
+	}
+	return append([]byte(nil), entry.Data...), nil
+}
+
+// Set saves session data. If ttl = 0, session never expires
+func (s *MemorySessionStore) Set(key SessionKey, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[key] = newSessionEntry(data, ttl)
+
+	if now := time.Now(); now.Sub(s.lastSweep) > memorySessionSweepInterval {
+		s.lastSweep = now
+		for k, entry := range s.sessions {
+			if entry.expired(now) {
+				delete(s.sessions, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes session
+func (s *MemorySessionStore) Delete(key SessionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+	return nil
+}
+
+// MigrateSessions moves sessions of oldChatID to newChatID. Sessions already stored for newChatID are kept
+func (s *MemorySessionStore) MigrateSessions(oldChatID, newChatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.sessions {
+		if key.ChatID != oldChatID {
+			continue
+		}
+		newKey := SessionKey{ChatID: newChatID, UserID: key.UserID}
+		if _, exists := s.sessions[newKey]; !exists {
+			s.sessions[newKey] = entry
+		}
+		delete(s.sessions, key)
+	}
+	return nil
+}
+
+// FileSessionStore keeps every session in a JSON file in directory, so sessions survive restarts
+type FileSessionStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileSessionStore creates session store in given directory, creating it if needed
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (s *FileSessionStore) path(key SessionKey) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d_%d.json", key.ChatID, key.UserID))
+}
+
+// Get returns session data or SessionNotFoundError
+func (s *FileSessionStore) Get(key SessionKey) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, SessionNotFoundError
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry sessionEntry
+	if err = json.Unmarshal(raw, &entry); err != nil {
+		return nil, fmt.Errorf("corrupted session %d_%d: %w", key.ChatID, key.UserID, err)
+	}
+	if entry.expired(time.Now()) {
+		_ = os.Remove(s.path(key))
+		return nil, SessionNotFoundError
+	}
+	return entry.Data, nil
+}
+
+// Set saves session data. If ttl = 0, session never expires
+func (s *FileSessionStore) Set(key SessionKey, data []byte, ttl time.Duration) error {
+	raw, err := json.Marshal(newSessionEntry(data, ttl))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// write to temporary file first, so session is never left half-written
+	tmp, err := os.CreateTemp(s.dir, "session-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+// Delete removes session
+func (s *FileSessionStore) Delete(key SessionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MigrateSessions moves session files of oldChatID to newChatID. Sessions already stored for newChatID are kept
+func (s *FileSessionStore) MigrateSessions(oldChatID, newChatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("%d_", oldChatID)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		userID, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		oldPath := filepath.Join(s.dir, name)
+		newPath := s.path(SessionKey{ChatID: newChatID, UserID: userID})
+		if _, err = os.Stat(newPath); err == nil {
+			err = os.Remove(oldPath)
+		} else if os.IsNotExist(err) {
+			err = os.Rename(oldPath, newPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package tgbot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	key := SessionKey{ChatID: -100, UserID: 42}
+
+	if _, err := store.Get(key); !errors.Is(err, SessionNotFoundError) {
+		t.Errorf("expected SessionNotFoundError, got %v", err)
+	}
+	if err := store.Set(key, []byte("data"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.Get(key); err != nil || string(data) != "data" {
+		t.Errorf("expected saved data, got %q, %v", data, err)
+	}
+	if _, err := store.Get(SessionKey{ChatID: -100}); !errors.Is(err, SessionNotFoundError) {
+		t.Errorf("sessions of different users must not mix, got %v", err)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(key); !errors.Is(err, SessionNotFoundError) {
+		t.Errorf("session must be deleted, got %v", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("deleting missing session must not fail, got %v", err)
+	}
+
+	if err := store.Set(key, []byte("data"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.Get(key); !errors.Is(err, SessionNotFoundError) {
+		t.Errorf("session must expire, got %v", err)
+	}
+
+	const oldChatID, newChatID = -123, -100123
+	sessions := map[SessionKey]string{
+		{ChatID: oldChatID, UserID: 1}:      "old 1",
+		{ChatID: oldChatID, UserID: 2}:      "old 2",
+		{ChatID: newChatID, UserID: 2}:      "new 2",
+		{ChatID: oldChatID * 10, UserID: 1}: "other",
+	}
+	for k, data := range sessions {
+		if err := store.Set(k, []byte(data), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.(SessionMigrator).MigrateSessions(oldChatID, newChatID); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[SessionKey]string{
+		{ChatID: newChatID, UserID: 1}:      "old 1",
+		{ChatID: newChatID, UserID: 2}:      "new 2",
+		{ChatID: oldChatID * 10, UserID: 1}: "other",
+	}
+	for k, want := range expected {
+		if data, err := store.Get(k); err != nil || string(data) != want {
+			t.Errorf("session %v: expected %q, got %q, %v", k, want, data, err)
+		}
+	}
+	for _, userID := range []int64{1, 2} {
+		if _, err := store.Get(SessionKey{ChatID: oldChatID, UserID: userID}); !errors.Is(err, SessionNotFoundError) {
+			t.Errorf("session of user %d must be moved from old chat, got %v", userID, err)
+		}
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	t.Parallel()
+	testSessionStore(t, NewMemorySessionStore())
+}
+
+func TestFileSessionStore(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, store)
+
+	key := SessionKey{ChatID: 1, UserID: 1}
+	if err = store.Set(key, []byte("persistent"), 0); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := restarted.Get(key); err != nil || string(data) != "persistent" {
+		t.Errorf("session must survive restart, got %q, %v", data, err)
+	}
+}
+
+func TestBotFramework_Session(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	type cart struct {
+		Items []string
+	}
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		var c cart
+		if err := bot.Session(update).Load(&c); err != nil && !errors.Is(err, SessionNotFoundError) {
+			return err
+		}
+		c.Items = append(c.Items, update.Message.Text)
+		return bot.Session(update).Save(c, time.Hour)
+	}, 0)
+
+	for _, item := range []string{"apple", "pear"} {
+		err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: 123},
+			From: &tgbotapi.User{ID: 42},
+			Text: item,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var c cart
+	session := &Session{store: bot.Sessions, key: SessionKey{ChatID: 123, UserID: 42}}
+	if err := session.Load(&c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Items) != 2 || c.Items[0] != "apple" || c.Items[1] != "pear" {
+		t.Errorf("unexpected session data %+v", c)
+	}
+}
+
+func TestBotFramework_SessionMigration(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	old := &Session{store: bot.Sessions, key: SessionKey{ChatID: -123, UserID: 42}}
+	if err := old.Save("data", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	bot.MigrateChat(-123, -100123)
+
+	var data string
+	migrated := &Session{store: bot.Sessions, key: SessionKey{ChatID: -100123, UserID: 42}}
+	if err := migrated.Load(&data); err != nil || data != "data" {
+		t.Errorf("session must be moved to new chat, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,92 @@
+package tgbot
+
+// prefixTree stores handlers by key prefix and finds the longest matching one.
+// It is not safe for concurrent use, callers must hold bot.mu
+type prefixTree struct {
+	root *prefixNode
+}
+
+type prefixNode struct {
+	children map[byte]*prefixNode
+	handlers map[int64]CommonHandler
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{root: &prefixNode{}}
+}
+
+// set binds handler f for given prefix and chat
+func (t *prefixTree) set(prefix string, chatID int64, f CommonHandler) {
+	node := t.root
+	for i := 0; i < len(prefix); i++ {
+		if node.children == nil {
+			node.children = make(map[byte]*prefixNode)
+		}
+		next, ok := node.children[prefix[i]]
+		if !ok {
+			next = &prefixNode{}
+			node.children[prefix[i]] = next
+		}
+		node = next
+	}
+	if node.handlers == nil {
+		node.handlers = make(map[int64]CommonHandler, 1)
+	}
+	node.handlers[chatID] = f
+}
+
+// remove deletes handler for given prefix and chat and prunes empty branches
+func (t *prefixTree) remove(prefix string, chatID int64) {
+	t.root.remove(prefix, chatID)
+}
+
+// remove returns true if node became empty and can be deleted by parent
+func (n *prefixNode) remove(prefix string, chatID int64) bool {
+	if prefix == "" {
+		delete(n.handlers, chatID)
+	} else if next, ok := n.children[prefix[0]]; ok && next.remove(prefix[1:], chatID) {
+		delete(n.children, prefix[0])
+	}
+	return len(n.handlers) == 0 && len(n.children) == 0
+}
+
+// match finds handler for key s with the longest registered prefix.
+// For the same prefix handler of given chat takes precedence over handler for chat 0.
+// Returns matched prefix length
+func (t *prefixTree) match(s string, chatID int64) (CommonHandler, int, bool) {
+	nodes := make([]*prefixNode, 0, len(s)+1)
+	node := t.root
+	nodes = append(nodes, node)
+	for i := 0; i < len(s); i++ {
+		next, ok := node.children[s[i]]
+		if !ok {
+			break
+		}
+		node = next
+		nodes = append(nodes, node)
+	}
+
+	for depth := len(nodes) - 1; depth >= 0; depth-- {
+		if f, ok := nodes[depth].handlers[chatID]; ok {
+			return f, depth, true
+		}
+		if f, ok := nodes[depth].handlers[0]; ok {
+			return f, depth, true
+		}
+	}
+	return nil, 0, false
+}
+
+// has reports whether handler is registered exactly for given prefix and chat
+func (t *prefixTree) has(prefix string, chatID int64) bool {
+	node := t.root
+	for i := 0; i < len(prefix); i++ {
+		next, ok := node.children[prefix[i]]
+		if !ok {
+			return false
+		}
+		node = next
+	}
+	_, ok := node.handlers[chatID]
+	return ok
+}
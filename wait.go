@@ -0,0 +1,109 @@
+package tgbot
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// messageWaiter is a pending WaitForMessage call
+type messageWaiter struct {
+	chatID int64 // changes when chat is migrated
+	filter func(message *tgbotapi.Message) bool
+	ch     chan *tgbotapi.Message
+}
+
+// WaitForMessage blocks until next message matching filter comes to the chat and returns it.
+// Matching message is intercepted before state and regular handlers, so they don't see it.
+// If filter is nil, any message of the chat matches. Filter must be fast and must not call bot methods.
+// If several calls wait for the same chat, message is given to the earliest one it matches.
+// Returns ctx error when ctx is done, use context.WithTimeout to limit waiting
+// For example:
+//
+//	ctx, cancel := context.WithTimeout(bot.Context(update), time.Minute)
+//	defer cancel()
+//	reply, err := bot.WaitForMessage(ctx, bot.GetChatID(update), func(message *tgbotapi.Message) bool {
+//		return message.From != nil && message.From.ID == update.Message.From.ID
+//	})
+func (bot *BotFramework) WaitForMessage(ctx context.Context, chatID int64, filter func(message *tgbotapi.Message) bool) (*tgbotapi.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w := &messageWaiter{chatID: chatID, filter: filter, ch: make(chan *tgbotapi.Message, 1)}
+
+	bot.waitersMu.Lock()
+	bot.waiters[chatID] = append(bot.waiters[chatID], w)
+	bot.waitersMu.Unlock()
+
+	select {
+	case message := <-w.ch:
+		return message, nil
+	case <-ctx.Done():
+	}
+
+	bot.waitersMu.Lock()
+	bot.removeWaiter(w)
+	bot.waitersMu.Unlock()
+
+	// message may be delivered right before waiter was removed
+	select {
+	case message := <-w.ch:
+		return message, nil
+	default:
+		return nil, ctx.Err()
+	}
+}
+
+// deliverToWaiter passes update.Message to the first matching waiter of its chat.
+// Migration messages are never delivered, waiters follow the chat to its new ID instead.
+// Returns true if message was delivered
+func (bot *BotFramework) deliverToWaiter(update *tgbotapi.Update) bool {
+	message := update.Message
+	if message == nil || message.Chat == nil || messageKind(message) == KindMigration {
+		return false
+	}
+
+	bot.waitersMu.Lock()
+	defer bot.waitersMu.Unlock()
+	for _, w := range bot.waiters[message.Chat.ID] {
+		if w.filter != nil && !w.filter(message) {
+			continue
+		}
+		bot.removeWaiter(w)
+		w.ch <- message
+		return true
+	}
+	return false
+}
+
+// removeWaiter deletes waiter of its chat. Caller must hold bot.waitersMu
+func (bot *BotFramework) removeWaiter(w *messageWaiter) {
+	chatID := w.chatID
+	waiters := bot.waiters[chatID]
+	for i := range waiters {
+		if waiters[i] == w {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(bot.waiters, chatID)
+		return
+	}
+	bot.waiters[chatID] = waiters
+}
+
+// migrateWaiters moves pending waiters of old chat to new one
+func (bot *BotFramework) migrateWaiters(oldChatID, newChatID int64) {
+	bot.waitersMu.Lock()
+	defer bot.waitersMu.Unlock()
+	waiters, ok := bot.waiters[oldChatID]
+	if !ok {
+		return
+	}
+	for _, w := range waiters {
+		w.chatID = newChatID
+	}
+	bot.waiters[newChatID] = append(bot.waiters[newChatID], waiters...)
+	delete(bot.waiters, oldChatID)
+}
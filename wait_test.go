@@ -0,0 +1,107 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestBotFramework_WaitForMessage(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+	bot.Dispatch = DispatchConfig{Workers: 1, OrderByChat: true}
+
+	replies := make(chan string, 1)
+	bot.RegisterCommand("/ask", func(bot *BotFramework, update *tgbotapi.Update) error {
+		ctx, cancel := context.WithTimeout(bot.Context(update), 5*time.Second)
+		defer cancel()
+		reply, err := bot.WaitForMessage(ctx, bot.GetChatID(update), func(message *tgbotapi.Message) bool {
+			return message.Text != "skip"
+		})
+		if err != nil {
+			return err
+		}
+		replies <- reply.Text
+		return nil
+	}, 0)
+	plain := make(chan string, 1)
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		plain <- update.Message.Text
+		return nil
+	}, 0)
+	bot.ErrorHandler = func(u tgbotapi.Update, err error) {
+		t.Error(err)
+	}
+
+	ch := make(chan tgbotapi.Update, 3)
+	ch <- tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: 1},
+		Text:     "/ask",
+		Entities: []tgbotapi.MessageEntity{{Offset: 0, Length: 4, Type: "bot_command"}},
+	}}
+	done := make(chan struct{})
+	go func() {
+		bot.HandleUpdates(ch)
+		close(done)
+	}()
+
+	for waiting := false; !waiting; {
+		time.Sleep(time.Millisecond)
+		bot.waitersMu.Lock()
+		waiting = len(bot.waiters[1]) > 0
+		bot.waitersMu.Unlock()
+	}
+	// both messages come while handler of the chat is still running
+	ch <- tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "skip"}}
+	ch <- tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "answer"}}
+
+	select {
+	case reply := <-replies:
+		if reply != "answer" {
+			t.Errorf("expected answer, got %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting handler didn't get reply")
+	}
+	select {
+	case text := <-plain:
+		if text != "skip" {
+			t.Errorf("expected skip to be handled as usual, got %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not matching filter must be handled as usual")
+	}
+
+	close(ch)
+	<-done
+}
+
+func TestBotFramework_WaitForMessageTimeout(t *testing.T) {
+	t.Parallel()
+	bot := getBot(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := bot.WaitForMessage(ctx, 1, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if len(bot.waiters) != 0 {
+		t.Error("waiter must be removed after timeout")
+	}
+
+	handled := false
+	bot.RegisterPlainTextHandler(func(bot *BotFramework, update *tgbotapi.Update) error {
+		handled = true
+		return nil
+	}, 0)
+	err := bot.HandleUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "late"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !handled {
+		t.Error("message after timeout must be handled as usual")
+	}
+}